@@ -0,0 +1,83 @@
+package errenvelope
+
+import "sync"
+
+// audiences maps an audience name to the detail keys it may see.
+var (
+	audiencesMu sync.RWMutex
+	audiences   = map[string]map[string]bool{}
+)
+
+// AllDetails, passed to RegisterAudience, lets an audience see every
+// detail, including non-map details such as ValidationDetails.
+const AllDetails = "*"
+
+// RegisterAudience defines which detail keys an audience may see, e.g.
+//
+//	errenvelope.RegisterAudience("public", "fields", "retry_policy")
+//	errenvelope.RegisterAudience("internal", errenvelope.AllDetails)
+//
+// Registering an audience again replaces its keys. Call at startup,
+// before serving requests; it is safe to call concurrently with
+// ForAudience.
+func RegisterAudience(audience string, keepKeys ...string) {
+	keep := make(map[string]bool, len(keepKeys))
+	for _, k := range keepKeys {
+		keep[k] = true
+	}
+	audiencesMu.Lock()
+	defer audiencesMu.Unlock()
+	audiences[audience] = keep
+}
+
+// ForAudience returns a copy of e whose details are filtered by the keys
+// registered for audience with RegisterAudience. Map details keep only
+// the allowed keys; ValidationDetails count as the "fields" key; any
+// other details are kept only for audiences registered with AllDetails.
+// An unregistered audience sees no details. Other fields are unchanged.
+func (e *Error) ForAudience(audience string) *Error {
+	if e == nil {
+		return nil
+	}
+	clone := *e
+	audiencesMu.RLock()
+	keep := audiences[audience]
+	audiencesMu.RUnlock()
+	if keep[AllDetails] {
+		return &clone
+	}
+
+	switch d := e.Details.(type) {
+	case nil:
+	case map[string]any:
+		out := make(map[string]any, len(d))
+		for k, v := range d {
+			if keep[k] {
+				out[k] = v
+			}
+		}
+		clone.Details = nilIfEmpty(out)
+	case map[string]string:
+		out := make(map[string]any, len(d))
+		for k, v := range d {
+			if keep[k] {
+				out[k] = v
+			}
+		}
+		clone.Details = nilIfEmpty(out)
+	case ValidationDetails, *ValidationDetails:
+		if !keep["fields"] {
+			clone.Details = nil
+		}
+	default:
+		clone.Details = nil
+	}
+	return &clone
+}
+
+func nilIfEmpty(m map[string]any) any {
+	if len(m) == 0 {
+		return nil
+	}
+	return m
+}
@@ -0,0 +1,61 @@
+package errenvelope
+
+import "testing"
+
+func registerTestAudience(t *testing.T, audience string, keepKeys ...string) {
+	t.Helper()
+	RegisterAudience(audience, keepKeys...)
+	t.Cleanup(func() {
+		audiencesMu.Lock()
+		defer audiencesMu.Unlock()
+		delete(audiences, audience)
+	})
+}
+
+func TestForAudience(t *testing.T) {
+	registerTestAudience(t, "public", "service")
+	registerTestAudience(t, "internal", AllDetails)
+
+	e := Unavailable("Payments are down").WithDetails(map[string]any{
+		"service": "payments",
+		"host":    "10.0.3.7",
+		"query":   "SELECT ...",
+	})
+
+	pub := e.ForAudience("public")
+	d, _ := pub.Details.(map[string]any)
+	if len(d) != 1 || d["service"] != "payments" {
+		t.Errorf("expected only public keys, got %v", pub.Details)
+	}
+	if pub.Message != e.Message || pub.Code != e.Code {
+		t.Errorf("expected other fields unchanged, got %+v", pub)
+	}
+	if len(e.Details.(map[string]any)) != 3 {
+		t.Error("expected the original details unchanged")
+	}
+
+	internal := e.ForAudience("internal")
+	if d := internal.Details.(map[string]any); len(d) != 3 || d["host"] != "10.0.3.7" {
+		t.Errorf("expected internal audience to keep every key, got %v", d)
+	}
+
+	if got := e.ForAudience("unknown").Details; got != nil {
+		t.Errorf("expected no details for an unregistered audience, got %v", got)
+	}
+}
+
+func TestForAudienceValidation(t *testing.T) {
+	registerTestAudience(t, "public", "fields")
+	registerTestAudience(t, "partner", "service")
+
+	e := Validation(FieldErrors{"email": "invalid"})
+	if _, ok := ValidationFields(e.ForAudience("public")); !ok {
+		t.Error("expected validation fields kept for an audience allowing fields")
+	}
+	if got := e.ForAudience("partner").Details; got != nil {
+		t.Errorf("expected validation fields dropped, got %v", got)
+	}
+	if (*Error)(nil).ForAudience("public") != nil {
+		t.Error("expected nil for nil error")
+	}
+}
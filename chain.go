@@ -0,0 +1,77 @@
+package errenvelope
+
+// ChainPolicy selects which *Error in a wrapped chain determines the
+// HTTP status in StatusFromChain.
+type ChainPolicy int
+
+const (
+	// Outermost uses the shallowest *Error, the one wrapped the fewest
+	// times. For a plain chain without joins this is the *Error
+	// errors.As finds.
+	Outermost ChainPolicy = iota
+	// Innermost uses the deepest *Error, closest to the root cause.
+	Innermost
+	// MostSevere uses the highest status, so a 5xx anywhere in the chain
+	// wins over a 4xx. For a join with envelopes in several branches this
+	// is the status of the Multi that From builds.
+	MostSevere
+)
+
+// StatusFromChain returns the HTTP status for err, choosing among the
+// *Error values in its chain according to policy. errors.Join branches
+// are all searched; depth counts wrap levels from err, so a join adds
+// one level to each branch. Ties in depth go to the earlier branch. An
+// *Error with no status counts as 500. If the chain holds no *Error, the
+// status of From(err) is returned. Returns 0 for a nil err.
+//
+//	// a 404 wrapped in a 500
+//	err := errenvelope.Wrap(errenvelope.CodeInternal, 500, "lookup failed", errenvelope.NotFound(""))
+//	errenvelope.StatusFromChain(err, errenvelope.Innermost)   // 404
+//	errenvelope.StatusFromChain(err, errenvelope.MostSevere) // 500
+func StatusFromChain(err error, policy ChainPolicy) int {
+	if err == nil {
+		return 0
+	}
+	status, chosen, found := 0, 0, false
+	walkChain(err, 0, func(e *Error, depth int) {
+		s := e.EffectiveStatus()
+		var better bool
+		switch policy {
+		case Innermost:
+			better = depth > chosen
+		case MostSevere:
+			better = s > status
+		default:
+			better = depth < chosen
+		}
+		if !found || better {
+			status, chosen, found = s, depth, true
+		}
+	})
+	if !found {
+		return From(err).Status
+	}
+	return status
+}
+
+// walkChain calls fn for every *Error in err's chain, depth-first, with
+// its depth below err.
+func walkChain(err error, depth int, fn func(e *Error, depth int)) {
+	for err != nil {
+		if e, ok := err.(*Error); ok && e != nil {
+			fn(e, depth)
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, inner := range u.Unwrap() {
+				walkChain(inner, depth+1, fn)
+			}
+			return
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+			depth++
+		default:
+			return
+		}
+	}
+}
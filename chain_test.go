@@ -0,0 +1,84 @@
+package errenvelope
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestStatusFromChain(t *testing.T) {
+	// 503 wrapping (via fmt) a 404 wrapping a 409
+	inner := Conflict("version mismatch")
+	middle := Wrap(CodeNotFound, http.StatusNotFound, "order missing", fmt.Errorf("store: %w", inner))
+	outer := Wrap(CodeUnavailable, 0, "", middle)
+	outer.Status = 0 // counts as 500
+
+	tests := []struct {
+		policy ChainPolicy
+		want   int
+	}{
+		{Outermost, http.StatusInternalServerError},
+		{Innermost, http.StatusConflict},
+		{MostSevere, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := StatusFromChain(fmt.Errorf("handler: %w", outer), tt.policy); got != tt.want {
+			t.Errorf("policy %d: expected %d, got %d", tt.policy, tt.want, got)
+		}
+	}
+
+	// A 5xx deep in the chain wins under MostSevere only
+	chain := Wrap(CodeBadRequest, http.StatusBadRequest, "", Unavailable(""))
+	if got := StatusFromChain(chain, MostSevere); got != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", got)
+	}
+	if got := StatusFromChain(chain, Outermost); got != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", got)
+	}
+
+	// errors.Join branches are all searched, by depth
+	joined := errors.Join(NotFound(""), fmt.Errorf("x: %w", Forbidden("")))
+	if got := StatusFromChain(joined, Innermost); got != http.StatusForbidden {
+		t.Errorf("expected 403 from the deeper branch, got %d", got)
+	}
+
+	// No *Error in the chain: mapped like From
+	if got := StatusFromChain(fmt.Errorf("q: %w", context.DeadlineExceeded), MostSevere); got != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %d", got)
+	}
+	if got := StatusFromChain(nil, Outermost); got != 0 {
+		t.Errorf("expected 0 for nil, got %d", got)
+	}
+}
+
+func TestStatusFromChainJoinDepths(t *testing.T) {
+	// The deepest envelope is in the first branch, the shallowest in the last
+	deep := fmt.Errorf("a: %w", fmt.Errorf("b: %w", NotFound("")))
+	joined := fmt.Errorf("handler: %w", errors.Join(deep, Conflict(""), fmt.Errorf("c: %w", Unavailable(""))))
+
+	tests := []struct {
+		policy ChainPolicy
+		want   int
+	}{
+		{Innermost, http.StatusNotFound},
+		{Outermost, http.StatusConflict},
+		{MostSevere, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		if got := StatusFromChain(joined, tt.policy); got != tt.want {
+			t.Errorf("policy %d: expected %d, got %d", tt.policy, tt.want, got)
+		}
+	}
+
+	// MostSevere agrees with the Multi that From builds for the join
+	if got := From(joined).Status; got != StatusFromChain(joined, MostSevere) {
+		t.Errorf("expected From's status %d to match MostSevere", got)
+	}
+
+	// Equal depths go to the earlier branch
+	if got := StatusFromChain(errors.Join(Gone(""), Conflict("")), Outermost); got != http.StatusGone {
+		t.Errorf("expected the first branch on a tie, got %d", got)
+	}
+}
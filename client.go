@@ -0,0 +1,162 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxEnvelopeBytes bounds how much of a body Parse and ReadFrom will read.
+const maxEnvelopeBytes = 1 << 20
+
+// ReadFrom decodes an envelope from r, e.g. a message queue payload or a
+// cached response body. It accepts a single envelope, an AlwaysArray list
+// (the first entry is returned), or a problem document written by
+// WriteProblem. retry_after is parsed back into RetryAfter.
+//
+// An error is returned if the body is not valid JSON or is not an
+// envelope (no "code" member). The returned Error has no Status; use
+// Parse to decode an HTTP response with its status and headers.
+func ReadFrom(r io.Reader) (*Error, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxEnvelopeBytes))
+	if err != nil {
+		return nil, fmt.Errorf("errenvelope: read envelope: %w", err)
+	}
+
+	var probe struct {
+		Errors []json.RawMessage `json:"errors"`
+		Detail string            `json:"detail"`
+		Status int               `json:"status"`
+	}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, fmt.Errorf("errenvelope: decode envelope: %w", err)
+	}
+	if len(probe.Errors) > 0 {
+		data = probe.Errors[0]
+	}
+
+	e := new(Error)
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, fmt.Errorf("errenvelope: decode envelope: %w", err)
+	}
+	if e.Code == "" {
+		return nil, errors.New("errenvelope: body is not an error envelope (missing code)")
+	}
+
+	// Problem documents carry the message as "detail" and the status inline.
+	if e.Message == "" {
+		e.Message = probe.Detail
+	}
+	e.Status = probe.Status
+	return e, nil
+}
+
+// FromMap builds an error from an already-decoded map, e.g. an upstream
+// SDK's parsed error body, without a re-marshal round trip. It reads the
+// envelope keys code, subcode, message, hint, help_url, details,
+// trace_id, span_id, error_id, retryable, transient, status, and
+// retry_after (a duration string such as "30s", or a number of seconds).
+// Missing or mistyped keys are skipped: a missing code becomes
+// CodeInternal, and a missing status is derived from the code. Returns
+// nil for a nil map.
+func FromMap(m map[string]any) *Error {
+	if m == nil {
+		return nil
+	}
+	str := func(key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+
+	e := &Error{
+		Code:    Code(str("code")),
+		Subcode: str("subcode"),
+		Message: str("message"),
+		Hint:    str("hint"),
+		HelpURL: str("help_url"),
+		Details: m["details"],
+		TraceID: str("trace_id"),
+		SpanID:  str("span_id"),
+		ErrorID: str("error_id"),
+	}
+	if e.Code == "" {
+		e.Code = CodeInternal
+	}
+	e.Retryable, _ = m["retryable"].(bool)
+	e.Transient, _ = m["transient"].(bool)
+	if status, ok := mapNumber(m["status"]); ok && status >= 100 && status <= 599 {
+		e.Status = int(status)
+	} else {
+		e.Status = StatusForCode(e.Code)
+	}
+
+	switch v := m["retry_after"].(type) {
+	case string:
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			e.RetryAfter = d
+		}
+	default:
+		if secs, ok := mapNumber(v); ok && secs > 0 && secs < float64(math.MaxInt64/int64(time.Second)) {
+			e.RetryAfter = time.Duration(secs * float64(time.Second))
+		}
+	}
+	return e
+}
+
+// mapNumber returns v as a float64 if it is a number, as decoded by
+// encoding/json or built in Go code.
+func mapNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// Parse decodes the error envelope from an HTTP response, for clients of
+// services that use err-envelope. Status comes from the response, and the
+// trace ID and Retry-After headers fill TraceID and RetryAfter when the
+// body doesn't carry them. The body is read but not closed.
+//
+// Example:
+//
+//	resp, err := client.Do(req)
+//	// ...
+//	if resp.StatusCode >= 400 {
+//	    e, err := errenvelope.Parse(resp)
+//	    if err == nil && e.Retryable {
+//	        time.Sleep(e.RetryAfter)
+//	    }
+//	}
+func Parse(resp *http.Response) (*Error, error) {
+	if resp == nil || resp.Body == nil {
+		return nil, errors.New("errenvelope: nil response body")
+	}
+	e, err := ReadFrom(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Status = resp.StatusCode
+	if e.TraceID == "" {
+		e.TraceID = resp.Header.Get(HeaderTraceID)
+	}
+	if e.RetryAfter == 0 {
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs > 0 {
+			e.RetryAfter = time.Duration(secs) * time.Second
+		}
+	}
+	return e, nil
+}
@@ -0,0 +1,234 @@
+package errenvelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadFrom(t *testing.T) {
+	original := RateLimited("Slow down").
+		WithDetails(map[string]any{"limit": float64(100)}).
+		WithTraceID("trace-1").
+		WithHint("Back off and retry").
+		WithRetryAfter(90 * time.Second)
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	e, err := ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("ReadFrom failed: %v", err)
+	}
+	if e.Code != CodeRateLimited || e.Message != "Slow down" {
+		t.Errorf("unexpected code/message: %s/%s", e.Code, e.Message)
+	}
+	if e.RetryAfter != 90*time.Second {
+		t.Errorf("expected retry_after to round-trip as 90s, got %v", e.RetryAfter)
+	}
+	if e.TraceID != "trace-1" || e.ErrorID != original.ErrorID || e.Hint != "Back off and retry" {
+		t.Errorf("expected trace/error IDs and hint to round-trip, got %+v", e)
+	}
+	if !e.Retryable {
+		t.Error("expected retryable to round-trip")
+	}
+	if details, _ := e.Details.(map[string]any); details["limit"] != float64(100) {
+		t.Errorf("expected details to round-trip, got %v", e.Details)
+	}
+}
+
+func TestReadFromShapes(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode Code
+		wantMsg  string
+	}{
+		{"array", `{"errors":[{"code":"NOT_FOUND","message":"gone","retryable":false}]}`, CodeNotFound, "gone"},
+		{"problem", `{"type":"about:blank","title":"Conflict","status":409,"detail":"taken","code":"CONFLICT","retryable":false}`, CodeConflict, "taken"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := ReadFrom(strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("ReadFrom failed: %v", err)
+			}
+			if e.Code != tt.wantCode || e.Message != tt.wantMsg {
+				t.Errorf("expected %s/%s, got %s/%s", tt.wantCode, tt.wantMsg, e.Code, e.Message)
+			}
+		})
+	}
+}
+
+func TestReadFromNotEnvelope(t *testing.T) {
+	for _, body := range []string{`{"status":"ok"}`, `not json`, `[1,2,3]`, `{"code":"X","retry_after":"soon"}`} {
+		if _, err := ReadFrom(strings.NewReader(body)); err == nil {
+			t.Errorf("expected error for %s", body)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Header.Set(HeaderTraceID, "trace-xyz")
+		Write(w, r, Unavailable("Down").WithRetryAfter(30*time.Second))
+	}))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	e, err := Parse(resp)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if e.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected status 503, got %d", e.Status)
+	}
+	if e.Code != CodeUnavailable || e.RetryAfter != 30*time.Second {
+		t.Errorf("unexpected envelope: %+v", e)
+	}
+	if e.TraceID != "trace-xyz" {
+		t.Errorf("expected trace ID, got %s", e.TraceID)
+	}
+}
+
+func TestParseHeaderFallback(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: http.StatusTooManyRequests,
+		Header:     http.Header{"Retry-After": {"7"}, HeaderTraceID: {"trace-h"}},
+		Body:       io.NopCloser(strings.NewReader(`{"code":"RATE_LIMITED","message":"Rate limited","retryable":true}`)),
+	}
+
+	e, err := Parse(resp)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if e.RetryAfter != 7*time.Second {
+		t.Errorf("expected RetryAfter from header, got %v", e.RetryAfter)
+	}
+	if e.TraceID != "trace-h" {
+		t.Errorf("expected trace ID from header, got %s", e.TraceID)
+	}
+
+	if _, err := Parse(nil); err == nil {
+		t.Error("expected error for nil response")
+	}
+}
+
+func TestUnmarshalJSONRejectsMalformed(t *testing.T) {
+	cases := map[string]string{
+		"array":             `[{"code":"NOT_FOUND"}]`,
+		"string":            `"NOT_FOUND"`,
+		"number":            `404`,
+		"overflow":          `{"code":"UNAVAILABLE","message":"down","retry_after":"999999999999h"}`,
+		"negative":          `{"code":"UNAVAILABLE","retry_after":"-5s"}`,
+		"garbage duration":  `{"code":"UNAVAILABLE","retry_after":"soon"}`,
+		"wrong field type":  `{"code":"NOT_FOUND","retryable":"yes"}`,
+		"too deeply nested": `{"code":"BAD_REQUEST","details":` + strings.Repeat("[", 20000) + strings.Repeat("]", 20000) + `}`,
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			e := &Error{Code: CodeInternal, Message: "untouched"}
+			if err := e.UnmarshalJSON([]byte(body)); err == nil {
+				t.Fatal("expected an error")
+			}
+			if e.Code != CodeInternal || e.Message != "untouched" || e.RetryAfter != 0 || e.Details != nil {
+				t.Errorf("expected envelope left unchanged, got %+v", e)
+			}
+			if _, err := ReadFrom(strings.NewReader(body)); err == nil {
+				t.Error("expected ReadFrom to fail")
+			}
+		})
+	}
+
+	e := &Error{Code: CodeInternal}
+	if err := e.UnmarshalJSON([]byte("null")); err != nil || e.Code != CodeInternal {
+		t.Errorf("expected null to be a no-op, got %v %+v", err, e)
+	}
+}
+
+func FuzzReadFrom(f *testing.F) {
+	seeds := []string{
+		`{"code":"NOT_FOUND","message":"User not found","retryable":false}`,
+		`{"code":"UNAVAILABLE","message":"down","retryable":true,"retry_after":"30s","details":{"service":"db"}}`,
+		`{"errors":[{"code":"VALIDATION_FAILED","details":{"fields":{"email":"invalid"}}}]}`,
+		`{"type":"about:blank","code":"CONFLICT","detail":"exists","status":409}`,
+		`{"code":"UNAVAILABLE","retry_after":"999999999999h"}`,
+		`{"code":"X","details":[[[[[[{"a":[1,2,{"b":null}]}]]]]]]}`,
+		`[1,2,3]`,
+		`null`,
+		``,
+	}
+	for _, s := range seeds {
+		f.Add([]byte(s))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		e, err := ReadFrom(bytes.NewReader(data))
+		if err != nil {
+			if e != nil {
+				t.Fatalf("got envelope %+v along with error %v", e, err)
+			}
+			return
+		}
+		if e.Code == "" {
+			t.Fatal("accepted an envelope without a code")
+		}
+		if e.RetryAfter < 0 {
+			t.Fatalf("accepted negative retry_after %v", e.RetryAfter)
+		}
+		// Anything accepted must survive a round trip
+		if _, err := json.Marshal(e); err != nil {
+			t.Fatalf("re-marshal accepted envelope: %v", err)
+		}
+	})
+}
+
+func TestFromMap(t *testing.T) {
+	e := FromMap(map[string]any{
+		"code":        "UNAVAILABLE",
+		"message":     "Payments are down",
+		"details":     map[string]any{"service": "payments"},
+		"trace_id":    "trace-upstream",
+		"retryable":   true,
+		"retry_after": "30s",
+	})
+	if e.Code != CodeUnavailable || e.Message != "Payments are down" || e.TraceID != "trace-upstream" {
+		t.Errorf("unexpected envelope: %+v", e)
+	}
+	if !e.Retryable || e.RetryAfter != 30*time.Second {
+		t.Errorf("expected retryable with 30s retry_after, got %v %v", e.Retryable, e.RetryAfter)
+	}
+	if e.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected status derived from code, got %d", e.Status)
+	}
+	if d, _ := e.Details.(map[string]any); d["service"] != "payments" {
+		t.Errorf("expected details kept, got %v", e.Details)
+	}
+
+	// Missing and mistyped fields are tolerated
+	e = FromMap(map[string]any{"message": 42, "status": float64(429), "retry_after": float64(5), "retryable": "yes"})
+	if e.Code != CodeInternal || e.Message != "" || e.Retryable {
+		t.Errorf("unexpected envelope from sparse map: %+v", e)
+	}
+	if e.Status != http.StatusTooManyRequests || e.RetryAfter != 5*time.Second {
+		t.Errorf("expected status 429 and 5s, got %d %v", e.Status, e.RetryAfter)
+	}
+	if e = FromMap(map[string]any{"code": "X", "retry_after": "soon"}); e.RetryAfter != 0 {
+		t.Errorf("expected invalid retry_after ignored, got %v", e.RetryAfter)
+	}
+
+	if FromMap(nil) != nil {
+		t.Error("expected nil for a nil map")
+	}
+}
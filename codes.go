@@ -1,5 +1,11 @@
 package errenvelope
 
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
 // Code is a stable, machine-readable error identifier.
 type Code string
 
@@ -9,18 +15,20 @@ const (
 	CodeBadRequest       Code = "BAD_REQUEST"
 	CodeNotFound         Code = "NOT_FOUND"
 	CodeMethodNotAllowed Code = "METHOD_NOT_ALLOWED"
+	CodeNotAcceptable    Code = "NOT_ACCEPTABLE"
 	CodeGone             Code = "GONE"
 	CodeConflict         Code = "CONFLICT"
+	CodeLengthRequired   Code = "LENGTH_REQUIRED"
 	CodePayloadTooLarge  Code = "PAYLOAD_TOO_LARGE"
 	CodeRequestTimeout   Code = "REQUEST_TIMEOUT"
 	CodeRateLimited      Code = "RATE_LIMITED"
 	CodeUnavailable      Code = "UNAVAILABLE"
 
 	// Validation / auth
-	CodeValidationFailed     Code = "VALIDATION_FAILED"
-	CodeUnauthorized         Code = "UNAUTHORIZED"
-	CodeForbidden            Code = "FORBIDDEN"
-	CodeUnprocessableEntity  Code = "UNPROCESSABLE_ENTITY"
+	CodeValidationFailed    Code = "VALIDATION_FAILED"
+	CodeUnauthorized        Code = "UNAUTHORIZED"
+	CodeForbidden           Code = "FORBIDDEN"
+	CodeUnprocessableEntity Code = "UNPROCESSABLE_ENTITY"
 
 	// Timeouts / cancellations
 	CodeTimeout  Code = "TIMEOUT"
@@ -30,3 +38,248 @@ const (
 	CodeDownstream        Code = "DOWNSTREAM_ERROR"
 	CodeDownstreamTimeout Code = "DOWNSTREAM_TIMEOUT"
 )
+
+// builtinCodes lists the codes defined by this package, in declaration order.
+var builtinCodes = []Code{
+	CodeInternal, CodeBadRequest, CodeNotFound, CodeMethodNotAllowed,
+	CodeNotAcceptable, CodeGone, CodeConflict, CodeLengthRequired,
+	CodePayloadTooLarge, CodeRequestTimeout, CodeRateLimited, CodeUnavailable,
+	CodeValidationFailed, CodeUnauthorized, CodeForbidden, CodeUnprocessableEntity,
+	CodeTimeout, CodeCanceled,
+	CodeDownstream, CodeDownstreamTimeout,
+}
+
+// Category groups codes for dashboards and SLOs.
+// It renders as its lowercase name in JSON and logs.
+type Category string
+
+// String returns the category's name, e.g. "downstream".
+func (c Category) String() string { return string(c) }
+
+const (
+	// CategoryAuth covers authentication and authorization failures.
+	CategoryAuth Category = "auth"
+	// CategoryClient covers other problems with the request.
+	CategoryClient Category = "client"
+	// CategoryServer covers failures of this service.
+	CategoryServer Category = "server"
+	// CategoryDownstream covers failures of services we depend on.
+	CategoryDownstream Category = "downstream"
+)
+
+// CodeInfo describes an application-defined code registered with RegisterCode.
+type CodeInfo struct {
+	Status    int      // HTTP status; 0 means 500
+	Message   string   // Default message when a constructor gets ""
+	Retryable bool     // Default retryable flag
+	Transient bool     // Default transient flag (expected to resolve on its own)
+	Category  Category // Dashboard group; derived from Status if empty
+}
+
+// registeredCodes holds application-defined codes added with RegisterCode.
+// It is read on every request, so access goes through codesMu.
+var (
+	codesMu         sync.RWMutex
+	registeredCodes = map[Code]CodeInfo{}
+)
+
+// lookupCode returns the CodeInfo of a registered code.
+func lookupCode(code Code) (CodeInfo, bool) {
+	codesMu.RLock()
+	defer codesMu.RUnlock()
+	info, ok := registeredCodes[code]
+	return info, ok
+}
+
+// registeredCodeList returns the registered codes in no particular order.
+func registeredCodeList() []Code {
+	codesMu.RLock()
+	defer codesMu.RUnlock()
+	codes := make([]Code, 0, len(registeredCodes))
+	for c := range registeredCodes {
+		codes = append(codes, c)
+	}
+	return codes
+}
+
+// RegisterCode adds an application-defined code, so New, StatusForCode,
+// and SchemaHandler know its status, default message, and retryability:
+//
+//	const CodeQuotaExceeded errenvelope.Code = "QUOTA_EXCEEDED"
+//
+//	errenvelope.RegisterCode(CodeQuotaExceeded, errenvelope.CodeInfo{
+//	    Status:  http.StatusPaymentRequired,
+//	    Message: "Quota exceeded",
+//	})
+//
+// It panics if code is empty, built in, or already registered.
+// Registration is meant for startup, before serving requests; it is safe
+// to call concurrently with New and Write, but a code registered late is
+// unknown to errors built before it.
+func RegisterCode(code Code, info CodeInfo) {
+	if code == "" {
+		panic("errenvelope: RegisterCode called with empty code")
+	}
+	if isBuiltinCode(code) {
+		panic("errenvelope: RegisterCode called with built-in code " + string(code))
+	}
+	if info.Status == 0 {
+		info.Status = http.StatusInternalServerError
+	}
+	if info.Category == "" {
+		info.Category = categoryForStatus(info.Status)
+	}
+
+	codesMu.Lock()
+	defer codesMu.Unlock()
+	if _, dup := registeredCodes[code]; dup {
+		panic("errenvelope: RegisterCode called twice for code " + string(code))
+	}
+	registeredCodes[code] = info
+}
+
+// Codes returns every known code, built-ins plus those added with
+// RegisterCode, sorted by name.
+func Codes() []Code {
+	codes := append(append([]Code{}, builtinCodes...), registeredCodeList()...)
+	sort.Slice(codes, func(i, j int) bool { return codes[i] < codes[j] })
+	return codes
+}
+
+func isBuiltinCode(code Code) bool {
+	for _, c := range builtinCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Category returns the dashboard group of the code: auth (401/403),
+// client (other 4xx), server, or downstream. Registered codes use their
+// CodeInfo category; unknown codes are server errors.
+func (c Code) Category() Category {
+	switch c {
+	case CodeUnauthorized, CodeForbidden:
+		return CategoryAuth
+	case CodeBadRequest, CodeValidationFailed, CodeNotFound, CodeMethodNotAllowed,
+		CodeNotAcceptable, CodeGone, CodeConflict, CodeLengthRequired,
+		CodePayloadTooLarge, CodeRequestTimeout, CodeUnprocessableEntity,
+		CodeRateLimited, CodeCanceled:
+		return CategoryClient
+	case CodeDownstream, CodeDownstreamTimeout:
+		return CategoryDownstream
+	case CodeInternal, CodeUnavailable, CodeTimeout:
+		return CategoryServer
+	}
+	if info, ok := lookupCode(c); ok {
+		return info.Category
+	}
+	return CategoryServer
+}
+
+func categoryForStatus(status int) Category {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return CategoryAuth
+	case status >= 400 && status < 500:
+		return CategoryClient
+	default:
+		return CategoryServer
+	}
+}
+
+// HTTPStatus returns the canonical HTTP status for the code.
+// It is shorthand for StatusForCode(c).
+func (c Code) HTTPStatus() int {
+	return StatusForCode(c)
+}
+
+// StatusForCode returns the canonical HTTP status for a code.
+// Registered codes use their CodeInfo status; unknown codes map to 500.
+func StatusForCode(code Code) int {
+	switch code {
+	case CodeBadRequest, CodeValidationFailed:
+		return http.StatusBadRequest
+	case CodeUnauthorized:
+		return http.StatusUnauthorized
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeMethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case CodeNotAcceptable:
+		return http.StatusNotAcceptable
+	case CodeRequestTimeout:
+		return http.StatusRequestTimeout
+	case CodeConflict:
+		return http.StatusConflict
+	case CodeGone:
+		return http.StatusGone
+	case CodeLengthRequired:
+		return http.StatusLengthRequired
+	case CodePayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case CodeUnprocessableEntity:
+		return http.StatusUnprocessableEntity
+	case CodeRateLimited:
+		return http.StatusTooManyRequests
+	case CodeCanceled:
+		return CanceledStatus
+	case CodeDownstream:
+		return http.StatusBadGateway
+	case CodeUnavailable:
+		return http.StatusServiceUnavailable
+	case CodeTimeout, CodeDownstreamTimeout:
+		return http.StatusGatewayTimeout
+	}
+	if info, ok := lookupCode(code); ok {
+		return info.Status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus returns the built-in code that best describes an HTTP
+// status; it is the inverse of StatusForCode for the built-in codes.
+// Unlisted 4xx statuses map to CodeBadRequest and everything else to CodeInternal.
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusNotAcceptable:
+		return CodeNotAcceptable
+	case http.StatusRequestTimeout:
+		return CodeRequestTimeout
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusGone:
+		return CodeGone
+	case http.StatusLengthRequired:
+		return CodeLengthRequired
+	case http.StatusRequestEntityTooLarge:
+		return CodePayloadTooLarge
+	case http.StatusUnprocessableEntity:
+		return CodeUnprocessableEntity
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway:
+		return CodeDownstream
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return CodeTimeout
+	}
+	if status >= 400 && status < 500 {
+		return CodeBadRequest
+	}
+	return CodeInternal
+}
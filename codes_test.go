@@ -0,0 +1,206 @@
+package errenvelope
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStatusForCode(t *testing.T) {
+	tests := []struct {
+		code Code
+		want int
+	}{
+		{CodeBadRequest, http.StatusBadRequest},
+		{CodeValidationFailed, http.StatusBadRequest},
+		{CodeUnauthorized, http.StatusUnauthorized},
+		{CodeNotFound, http.StatusNotFound},
+		{CodeNotAcceptable, http.StatusNotAcceptable},
+		{CodeLengthRequired, http.StatusLengthRequired},
+		{CodePayloadTooLarge, http.StatusRequestEntityTooLarge},
+		{CodeRateLimited, http.StatusTooManyRequests},
+		{CodeCanceled, 499},
+		{CodeDownstream, http.StatusBadGateway},
+		{CodeDownstreamTimeout, http.StatusGatewayTimeout},
+		{CodeInternal, http.StatusInternalServerError},
+		{Code("UNKNOWN"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.code), func(t *testing.T) {
+			if got := StatusForCode(tt.code); got != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCodeHTTPStatus(t *testing.T) {
+	tests := map[Code]int{
+		CodeNotFound:         http.StatusNotFound,
+		CodeValidationFailed: http.StatusBadRequest,
+		CodeRateLimited:      http.StatusTooManyRequests,
+		CodeUnavailable:      http.StatusServiceUnavailable,
+		CodeTimeout:          http.StatusGatewayTimeout,
+		Code("UNKNOWN"):      http.StatusInternalServerError,
+	}
+	for code, want := range tests {
+		if got := code.HTTPStatus(); got != want {
+			t.Errorf("%s.HTTPStatus() = %d, want %d", code, got, want)
+		}
+		if got, want := code.HTTPStatus(), StatusForCode(code); got != want {
+			t.Errorf("%s.HTTPStatus() = %d, StatusForCode = %d", code, got, want)
+		}
+	}
+}
+
+// declaredCodes parses codes.go and returns the values of its Code constants.
+func declaredCodes(t *testing.T) []Code {
+	t.Helper()
+	f, err := parser.ParseFile(token.NewFileSet(), "codes.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parse codes.go: %v", err)
+	}
+	var codes []Code
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.CONST {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			vs := spec.(*ast.ValueSpec)
+			if ident, ok := vs.Type.(*ast.Ident); !ok || ident.Name != "Code" {
+				continue
+			}
+			for _, v := range vs.Values {
+				lit := v.(*ast.BasicLit)
+				s, _ := strconv.Unquote(lit.Value)
+				codes = append(codes, Code(s))
+			}
+		}
+	}
+	return codes
+}
+
+func TestCodes(t *testing.T) {
+	registerTestCode(t, "QUOTA_EXCEEDED", CodeInfo{Status: http.StatusPaymentRequired})
+
+	codes := Codes()
+	if !sort.SliceIsSorted(codes, func(i, j int) bool { return codes[i] < codes[j] }) {
+		t.Errorf("expected sorted codes, got %v", codes)
+	}
+
+	known := map[Code]bool{}
+	for _, c := range codes {
+		known[c] = true
+	}
+	declared := declaredCodes(t)
+	if len(declared) == 0 {
+		t.Fatal("found no Code constants in codes.go")
+	}
+	for _, c := range declared {
+		if !known[c] {
+			t.Errorf("Codes() is missing %s declared in codes.go", c)
+		}
+	}
+	if !known["QUOTA_EXCEEDED"] {
+		t.Error("Codes() is missing registered QUOTA_EXCEEDED")
+	}
+	if len(codes) != len(declared)+1 {
+		t.Errorf("expected %d codes, got %d", len(declared)+1, len(codes))
+	}
+}
+
+func TestCodeCategory(t *testing.T) {
+	tests := map[Code]Category{
+		CodeUnauthorized:      CategoryAuth,
+		CodeForbidden:         CategoryAuth,
+		CodeValidationFailed:  CategoryClient,
+		CodeNotFound:          CategoryClient,
+		CodeInternal:          CategoryServer,
+		CodeUnavailable:       CategoryServer,
+		CodeDownstream:        CategoryDownstream,
+		CodeDownstreamTimeout: CategoryDownstream,
+		Code("UNKNOWN"):       CategoryServer,
+	}
+	for code, want := range tests {
+		if got := code.Category(); got != want {
+			t.Errorf("%s.Category() = %s, want %s", code, got, want)
+		}
+	}
+
+	if got := NotFound("x").Category(); got != CategoryClient {
+		t.Errorf("expected Error.Category to follow its code, got %s", got)
+	}
+	if got := (*Error)(nil).Category(); got != "" {
+		t.Errorf("expected empty category for nil error, got %s", got)
+	}
+}
+
+func TestRegisterCodeCategory(t *testing.T) {
+	registerTestCode(t, "LEDGER_DOWN", CodeInfo{Status: http.StatusBadGateway, Category: CategoryDownstream})
+	registerTestCode(t, "TOKEN_REVOKED", CodeInfo{Status: http.StatusUnauthorized})
+	registerTestCode(t, "QUOTA_EXCEEDED", CodeInfo{Status: http.StatusPaymentRequired})
+
+	tests := map[Code]Category{
+		"LEDGER_DOWN":    CategoryDownstream,
+		"TOKEN_REVOKED":  CategoryAuth,
+		"QUOTA_EXCEEDED": CategoryClient,
+	}
+	for code, want := range tests {
+		if got := code.Category(); got != want {
+			t.Errorf("%s.Category() = %s, want %s", code, got, want)
+		}
+	}
+}
+
+// Run with -race: registration may overlap with requests reading the
+// registries, even though it is meant for startup.
+func TestRegistriesConcurrentAccess(t *testing.T) {
+	const code Code = "TEST_CONCURRENT_REGISTRY"
+	t.Cleanup(func() {
+		codesMu.Lock()
+		defer codesMu.Unlock()
+		delete(registeredCodes, code)
+	})
+	t.Cleanup(func() { SetDefaultRetryAfter(code, 0) })
+	t.Cleanup(func() { SetRetryableOnAnyMethod(code, false) })
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				e := New(code, 0, "")
+				_ = e.Category()
+				_ = StatusForCode(code)
+				_ = Codes()
+				_ = isRetryableOnAnyMethod(code)
+			}
+		}()
+	}
+
+	RegisterCode(code, CodeInfo{Status: http.StatusPaymentRequired, Message: "Pay up", Retryable: true})
+	SetDefaultRetryAfter(code, time.Second)
+	SetRetryableOnAnyMethod(code, true)
+	close(stop)
+	wg.Wait()
+
+	e := New(code, 0, "")
+	if e.Message != "Pay up" || !e.Retryable || e.RetryAfter != time.Second {
+		t.Errorf("expected registered defaults, got %+v", e)
+	}
+}
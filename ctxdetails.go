@@ -0,0 +1,59 @@
+package errenvelope
+
+import (
+	"context"
+	"net/http"
+)
+
+const detailsKey ctxKey = "errenvelope.details"
+
+// DetailFunc is a detail value computed when the response is written,
+// e.g. the time elapsed since the request started.
+type DetailFunc func() any
+
+// ContextWithDetail returns a context carrying a request-scoped detail.
+// Write, WriteProblem, and WriteLegacy add the context's details to the
+// error they write, so middleware can enrich every error of a request
+// without touching the handler. A DetailFunc value is called at write
+// time. The error's own details win on conflicting keys, and details
+// that aren't a map are left unchanged.
+//
+//	ctx := errenvelope.ContextWithDetail(r.Context(), "tenant", tenantID)
+//	next.ServeHTTP(w, r.WithContext(ctx))
+func ContextWithDetail(ctx context.Context, key string, value any) context.Context {
+	prev, _ := ctx.Value(detailsKey).(map[string]any)
+	next := make(map[string]any, len(prev)+1)
+	for k, v := range prev {
+		next[k] = v
+	}
+	next[key] = value
+	return context.WithValue(ctx, detailsKey, next)
+}
+
+// mergeContextDetails returns details with the request's context details
+// added, copying rather than modifying the map.
+func mergeContextDetails(details any, r *http.Request) any {
+	if r == nil {
+		return details
+	}
+	extra, _ := r.Context().Value(detailsKey).(map[string]any)
+	if len(extra) == 0 {
+		return details
+	}
+	own, isMap := details.(map[string]any)
+	if details != nil && !isMap {
+		return details
+	}
+
+	d := make(map[string]any, len(own)+len(extra))
+	for k, v := range extra {
+		if fn, ok := v.(DetailFunc); ok {
+			v = fn()
+		}
+		d[k] = v
+	}
+	for k, v := range own {
+		d[k] = v
+	}
+	return d
+}
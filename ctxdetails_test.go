@@ -0,0 +1,54 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextDetails(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx := ContextWithDetail(r.Context(), "tenant", "acme")
+	ctx = ContextWithDetail(ctx, "region", "eu-west-1")
+	calls := 0
+	ctx = ContextWithDetail(ctx, "lazy", DetailFunc(func() any { calls++; return "computed" }))
+	r = r.WithContext(ctx)
+
+	orig := NotFound("").WithDetails(map[string]any{"region": "own"})
+	w := httptest.NewRecorder()
+	Write(w, r, orig)
+
+	var body struct {
+		Details map[string]any `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Details["tenant"] != "acme" || body.Details["lazy"] != "computed" {
+		t.Errorf("expected context details in body, got %v", body.Details)
+	}
+	if body.Details["region"] != "own" {
+		t.Errorf("expected the error's own details to win, got %v", body.Details["region"])
+	}
+	if calls != 1 {
+		t.Errorf("expected DetailFunc called once at write time, got %d", calls)
+	}
+	if len(orig.Details.(map[string]any)) != 1 {
+		t.Error("expected the caller's details unchanged")
+	}
+
+	// Non-map details are left alone
+	w = httptest.NewRecorder()
+	Write(w, r, Validation(FieldErrors{"email": "invalid"}))
+	if e, err := ReadFrom(w.Body); err != nil {
+		t.Fatal(err)
+	} else if _, ok := e.Details.(map[string]any)["tenant"]; ok {
+		t.Errorf("expected validation details untouched, got %v", e.Details)
+	}
+
+	// A parent context is not affected by derived ones
+	_ = ContextWithDetail(r.Context(), "extra", 1)
+	if _, ok := r.Context().Value(detailsKey).(map[string]any)["extra"]; ok {
+		t.Error("expected ContextWithDetail not to modify the parent context")
+	}
+}
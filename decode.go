@@ -0,0 +1,83 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FromJSONDecodeError maps errors from decoding a JSON request body into
+// a 400 BAD_REQUEST with a helpful message, instead of a generic 500:
+//
+//   - *json.SyntaxError: malformed JSON, with the byte offset
+//   - *json.UnmarshalTypeError: wrong type for a field, with field and offset
+//   - io.EOF: empty body
+//   - io.ErrUnexpectedEOF: truncated body
+//   - unknown fields (Decoder.DisallowUnknownFields): the offending field
+//
+// Anything else is mapped with From. The decode error is kept as the cause.
+//
+// Example:
+//
+//	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+//	    errenvelope.Write(w, r, errenvelope.FromJSONDecodeError(err))
+//	    return
+//	}
+func FromJSONDecodeError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+
+	var e *Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		e = BadRequestf("Malformed JSON at offset %d", syntaxErr.Offset).
+			WithDetails(map[string]any{"offset": syntaxErr.Offset})
+	case errors.As(err, &typeErr):
+		field := typeErr.Field
+		if field == "" {
+			field = "(root)"
+		}
+		e = BadRequestf("Invalid value for field %q: expected %s", field, typeErr.Type).
+			WithDetails(map[string]any{
+				"field":  field,
+				"offset": typeErr.Offset,
+			})
+	case errors.Is(err, io.EOF):
+		e = BadRequest("Request body is empty")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		e = BadRequest("Malformed JSON: unexpected end of input")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		e = BadRequest(fmt.Sprintf("Unknown field %q", field)).
+			WithDetails(map[string]any{"field": field})
+	default:
+		return From(err)
+	}
+
+	e.Cause = err
+	return e
+}
+
+// ParseError creates a bad request error (400) for a body that parsed but
+// has a problem at a known location. Details carry the location as an RFC
+// 6901 JSON Pointer and the message, so clients can highlight the
+// offending part:
+//
+//	errenvelope.ParseError("/items/2/price", "must be a decimal string")
+//	// details: {"pointer": "/items/2/price", "message": "must be a decimal string"}
+//
+// If msg is empty, "Invalid request body" is used.
+func ParseError(pointer, msg string) *Error {
+	if msg == "" {
+		msg = "Invalid request body"
+	}
+	return BadRequest(msg).WithDetails(map[string]any{
+		"pointer": pointer,
+		"message": msg,
+	})
+}
@@ -0,0 +1,114 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func decodeErr(body string, disallowUnknown bool) error {
+	var v struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	dec := json.NewDecoder(strings.NewReader(body))
+	if disallowUnknown {
+		dec.DisallowUnknownFields()
+	}
+	return dec.Decode(&v)
+}
+
+func TestFromJSONDecodeError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		wantMessage string
+		wantField   string
+	}{
+		{"syntax", decodeErr(`{"name": }`, false), "Malformed JSON at offset 10", ""},
+		{"type", decodeErr(`{"age": "old"}`, false), `Invalid value for field "age": expected int`, "age"},
+		{"empty", decodeErr(``, false), "Request body is empty", ""},
+		{"truncated", decodeErr(`{"name": "ada"`, false), "Malformed JSON: unexpected end of input", ""},
+		{"unknown field", decodeErr(`{"email": "a@b.co"}`, true), `Unknown field "email"`, "email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.err == nil {
+				t.Fatal("expected decode error")
+			}
+			e := FromJSONDecodeError(tt.err)
+
+			if e.Code != CodeBadRequest {
+				t.Errorf("expected code %s, got %s", CodeBadRequest, e.Code)
+			}
+			if e.Status != http.StatusBadRequest {
+				t.Errorf("expected status %d, got %d", http.StatusBadRequest, e.Status)
+			}
+			if e.Message != tt.wantMessage {
+				t.Errorf("expected message %q, got %q", tt.wantMessage, e.Message)
+			}
+			if !errors.Is(e, tt.err) {
+				t.Error("expected decode error to be kept as cause")
+			}
+			if tt.wantField != "" {
+				details, _ := e.Details.(map[string]any)
+				if details["field"] != tt.wantField {
+					t.Errorf("expected field %s in details, got %v", tt.wantField, details)
+				}
+			}
+		})
+	}
+}
+
+func TestFromJSONDecodeErrorDirectSentinels(t *testing.T) {
+	if e := FromJSONDecodeError(io.EOF); e.Code != CodeBadRequest {
+		t.Errorf("expected BAD_REQUEST for io.EOF, got %s", e.Code)
+	}
+	if e := FromJSONDecodeError(io.ErrUnexpectedEOF); e.Code != CodeBadRequest {
+		t.Errorf("expected BAD_REQUEST for io.ErrUnexpectedEOF, got %s", e.Code)
+	}
+}
+
+func TestFromJSONDecodeErrorFallback(t *testing.T) {
+	if FromJSONDecodeError(nil) != nil {
+		t.Error("expected nil for nil error")
+	}
+	if e := FromJSONDecodeError(errors.New("disk on fire")); e.Code != CodeInternal {
+		t.Errorf("expected INTERNAL for unrelated error, got %s", e.Code)
+	}
+	if e := FromJSONDecodeError(Unauthorized("no token")); e.Code != CodeUnauthorized {
+		t.Errorf("expected envelope passthrough, got %s", e.Code)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("POST", "/orders", nil), ParseError("/items/2/price", "must be a decimal string"))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", w.Code)
+	}
+	var body struct {
+		Code    Code              `json:"code"`
+		Message string            `json:"message"`
+		Details map[string]string `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Code != CodeBadRequest || body.Message != "must be a decimal string" {
+		t.Errorf("unexpected envelope: %+v", body)
+	}
+	if body.Details["pointer"] != "/items/2/price" || body.Details["message"] != "must be a decimal string" {
+		t.Errorf("expected pointer and message in details, got %v", body.Details)
+	}
+
+	if e := ParseError("", ""); e.Message != "Invalid request body" {
+		t.Errorf("expected default message, got %q", e.Message)
+	}
+}
@@ -0,0 +1,202 @@
+package errenvelope
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// normalizeDetails makes detail values serialize predictably in both JSON
+// and logs: error values become their Error() text and fmt.Stringer values
+// their String(), instead of their struct fields. Values with their own
+// JSON or text encoding (time.Time, RetryPolicy, ...) are kept as-is.
+// Nested map[string]any and []any are walked; other shapes are returned
+// unchanged. Maps and slices are copied only when something changes.
+func normalizeDetails(v any) any {
+	out, _ := normalizeValue(v)
+	return out
+}
+
+func normalizeValue(v any) (any, bool) {
+	switch x := v.(type) {
+	case nil, string, json.Marshaler, encoding.TextMarshaler:
+		return v, false
+	case error:
+		return x.Error(), true
+	case fmt.Stringer:
+		return x.String(), true
+	case map[string]any:
+		var out map[string]any
+		for k, val := range x {
+			nv, changed := normalizeValue(val)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = make(map[string]any, len(x))
+				for k2, v2 := range x {
+					out[k2] = v2
+				}
+			}
+			out[k] = nv
+		}
+		if out == nil {
+			return x, false
+		}
+		return out, true
+	case []any:
+		var out []any
+		for i, val := range x {
+			nv, changed := normalizeValue(val)
+			if !changed {
+				continue
+			}
+			if out == nil {
+				out = append([]any(nil), x...)
+			}
+			out[i] = nv
+		}
+		if out == nil {
+			return x, false
+		}
+		return out, true
+	}
+	return v, false
+}
+
+// withDetail returns a copy of e with key set in its map details,
+// copying the map so shared errors are never mutated. Nil details start
+// a new map. Details of any other shape are left unchanged.
+func (e *Error) withDetail(key string, v any) *Error {
+	clone := *e
+	var d map[string]any
+	switch cur := e.Details.(type) {
+	case nil:
+		d = make(map[string]any, 1)
+	case map[string]any:
+		d = make(map[string]any, len(cur)+1)
+		for k, val := range cur {
+			d[k] = val
+		}
+	default:
+		return &clone
+	}
+	d[key] = v
+	clone.Details = d
+	return &clone
+}
+
+// RetryPolicy tells clients and sidecars how aggressively to retry, so
+// retryable errors don't blow through a mesh's retry budget. It is stored
+// in Details under "retry_policy" by WithRetryPolicy.
+type RetryPolicy struct {
+	MaxAttempts int           // Total attempts the client should make
+	Backoff     time.Duration // Base delay between attempts
+}
+
+// MarshalJSON renders the backoff as a duration string, like retry_after:
+// {"max_attempts": 3, "backoff": "200ms"}.
+func (p RetryPolicy) MarshalJSON() ([]byte, error) {
+	aux := struct {
+		MaxAttempts int    `json:"max_attempts"`
+		Backoff     string `json:"backoff,omitempty"`
+	}{MaxAttempts: p.MaxAttempts}
+	if p.Backoff > 0 {
+		aux.Backoff = p.Backoff.String()
+	}
+	return json.Marshal(aux)
+}
+
+// WithRetryPolicy records how many attempts clients should make and the
+// base backoff between them, in Details under "retry_policy". Details must
+// be nil or a map[string]any; other detail shapes are left unchanged.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithRetryPolicy(attempts int, backoff time.Duration) *Error {
+	return e.withDetail("retry_policy", RetryPolicy{MaxAttempts: attempts, Backoff: backoff})
+}
+
+// RetryPolicy returns the policy set by WithRetryPolicy, including from an
+// envelope decoded from JSON. Returns false if none is set.
+func (e *Error) RetryPolicy() (RetryPolicy, bool) {
+	if e == nil {
+		return RetryPolicy{}, false
+	}
+	d, ok := e.Details.(map[string]any)
+	if !ok {
+		return RetryPolicy{}, false
+	}
+	switch p := d["retry_policy"].(type) {
+	case RetryPolicy:
+		return p, true
+	case map[string]any: // after a JSON round-trip
+		var rp RetryPolicy
+		if n, ok := p["max_attempts"].(float64); ok {
+			rp.MaxAttempts = int(n)
+		}
+		if s, ok := p["backoff"].(string); ok {
+			rp.Backoff, _ = time.ParseDuration(s)
+		}
+		return rp, true
+	}
+	return RetryPolicy{}, false
+}
+
+// DetailsSlice returns the error's details as a []T for errors whose
+// details are a list (e.g. the records in a batch that failed).
+//
+// It accepts the native slice set with WithDetails([]T{...}) as well as
+// the []any produced by decoding an envelope from JSON, whose elements
+// are converted to T. Returns false if e is nil, has no details, or the
+// details are not a list convertible to []T.
+//
+// Example:
+//
+//	type FailedRecord struct {
+//	    ID     string `json:"id"`
+//	    Reason string `json:"reason"`
+//	}
+//	err := errenvelope.BadRequest("Some records failed").
+//	    WithDetails([]FailedRecord{{ID: "42", Reason: "duplicate"}})
+//
+//	records, ok := errenvelope.DetailsSlice[FailedRecord](err)
+func DetailsSlice[T any](e *Error) ([]T, bool) {
+	if e == nil || e.Details == nil {
+		return nil, false
+	}
+	switch v := e.Details.(type) {
+	case []T:
+		return v, true
+	case []any:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, false
+		}
+		var out []T
+		if err := json.Unmarshal(data, &out); err != nil {
+			return nil, false
+		}
+		return out, true
+	default:
+		return nil, false
+	}
+}
+
+// withoutDetail returns map details without key, copying rather than
+// mutating, or nil if nothing is left. Other shapes are returned unchanged.
+func withoutDetail(details any, key string) any {
+	d, ok := details.(map[string]any)
+	if !ok {
+		return details
+	}
+	if _, ok := d[key]; !ok {
+		return details
+	}
+	out := make(map[string]any, len(d)-1)
+	for k, v := range d {
+		if k != key {
+			out[k] = v
+		}
+	}
+	return nilIfEmpty(out)
+}
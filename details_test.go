@@ -0,0 +1,181 @@
+package errenvelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+type failedRecord struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+func TestDetailsSliceNative(t *testing.T) {
+	records := []failedRecord{{ID: "1", Reason: "duplicate"}, {ID: "7", Reason: "missing name"}}
+	e := BadRequest("Some records failed").WithDetails(records)
+
+	got, ok := DetailsSlice[failedRecord](e)
+	if !ok {
+		t.Fatal("expected native slice details")
+	}
+	if len(got) != 2 || got[1].ID != "7" {
+		t.Errorf("unexpected records: %+v", got)
+	}
+}
+
+func TestDetailsSliceRoundTrip(t *testing.T) {
+	e := BadRequest("Some records failed").
+		WithDetails([]failedRecord{{ID: "1", Reason: "duplicate"}})
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+
+	var raw map[string]any
+	_ = json.Unmarshal(data, &raw)
+	if _, isArray := raw["details"].([]any); !isArray {
+		t.Fatalf("expected details serialized as array, got %s", data)
+	}
+
+	decoded := &Error{Details: raw["details"]}
+	got, ok := DetailsSlice[failedRecord](decoded)
+	if !ok {
+		t.Fatal("expected post-JSON []any details to convert")
+	}
+	if len(got) != 1 || got[0] != (failedRecord{ID: "1", Reason: "duplicate"}) {
+		t.Errorf("unexpected records after round-trip: %+v", got)
+	}
+}
+
+func TestDetailsSliceMismatch(t *testing.T) {
+	if _, ok := DetailsSlice[failedRecord](nil); ok {
+		t.Error("expected false for nil error")
+	}
+	if _, ok := DetailsSlice[failedRecord](BadRequest("x")); ok {
+		t.Error("expected false for missing details")
+	}
+	if _, ok := DetailsSlice[failedRecord](BadRequest("x").WithDetails(map[string]any{"id": "1"})); ok {
+		t.Error("expected false for map details")
+	}
+	if _, ok := DetailsSlice[int](BadRequest("x").WithDetails([]any{"not", "ints"})); ok {
+		t.Error("expected false for unconvertible elements")
+	}
+}
+
+func TestWithRetryPolicy(t *testing.T) {
+	original := Unavailable("busy").WithDetails(map[string]any{"region": "eu-west-1"})
+	e := original.WithRetryPolicy(3, 200*time.Millisecond)
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var body struct {
+		Details map[string]any `json:"details"`
+	}
+	_ = json.Unmarshal(data, &body)
+	policy, _ := body.Details["retry_policy"].(map[string]any)
+	if policy["max_attempts"] != float64(3) || policy["backoff"] != "200ms" {
+		t.Errorf("expected serialized policy, got %s", data)
+	}
+	if body.Details["region"] != "eu-west-1" {
+		t.Error("expected existing details to be kept")
+	}
+	if _, mutated := original.Details.(map[string]any)["retry_policy"]; mutated {
+		t.Error("WithRetryPolicy should not mutate the original details")
+	}
+
+	var decoded Error
+	_ = json.Unmarshal(data, &decoded)
+	if p, ok := decoded.RetryPolicy(); !ok || p != (RetryPolicy{MaxAttempts: 3, Backoff: 200 * time.Millisecond}) {
+		t.Errorf("expected policy to round-trip, got %+v (%v)", p, ok)
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Warn("busy", "error", e)
+	if !bytes.Contains(buf.Bytes(), []byte(`"retry_policy":{"max_attempts":3,"backoff":200000000}`)) {
+		t.Errorf("expected retry_policy in log output, got %s", buf.String())
+	}
+	if n := bytes.Count(buf.Bytes(), []byte(`"retry_policy"`)); n != 1 {
+		t.Errorf("expected retry_policy logged once, got %d times: %s", n, buf.String())
+	}
+
+	// Other details are still logged
+	buf.Reset()
+	slog.New(slog.NewJSONHandler(&buf, nil)).Warn("busy", "error", e.withDetail("service", "billing"))
+	if !bytes.Contains(buf.Bytes(), []byte(`"service":"billing"`)) {
+		t.Errorf("expected remaining details logged, got %s", buf.String())
+	}
+}
+
+func TestRetryPolicyOmittedWhenUnset(t *testing.T) {
+	e := Unavailable("busy")
+	if _, ok := e.RetryPolicy(); ok {
+		t.Error("expected no policy")
+	}
+	data, _ := json.Marshal(e)
+	if bytes.Contains(data, []byte("retry_policy")) {
+		t.Errorf("expected retry_policy omitted, got %s", data)
+	}
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Warn("busy", "error", e)
+	if bytes.Contains(buf.Bytes(), []byte("retry_policy")) {
+		t.Errorf("expected retry_policy omitted from logs, got %s", buf.String())
+	}
+}
+
+type region struct{ name, zone string }
+
+func (r region) String() string { return r.name + "/" + r.zone }
+
+func TestDetailsNormalizeStringer(t *testing.T) {
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	e := Unavailable("busy").WithDetails(map[string]any{
+		"region":  region{"eu-west-1", "b"},
+		"cause":   errors.New("pool exhausted"),
+		"since":   at,
+		"nested":  map[string]any{"region": region{"us-east-1", "a"}},
+		"regions": []any{region{"ap-south-1", "c"}},
+		"count":   3,
+	})
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var body struct {
+		Details map[string]any `json:"details"`
+	}
+	_ = json.Unmarshal(data, &body)
+	d := body.Details
+	if d["region"] != "eu-west-1/b" {
+		t.Errorf("expected Stringer rendered via String(), got %v", d["region"])
+	}
+	if d["cause"] != "pool exhausted" {
+		t.Errorf("expected error rendered via Error(), got %v", d["cause"])
+	}
+	if d["since"] != "2026-03-01T12:00:00Z" {
+		t.Errorf("expected time.Time kept as RFC 3339, got %v", d["since"])
+	}
+	if d["nested"].(map[string]any)["region"] != "us-east-1/a" || d["regions"].([]any)[0] != "ap-south-1/c" {
+		t.Errorf("expected nested values normalized, got %v", d)
+	}
+	if d["count"] != float64(3) {
+		t.Errorf("expected plain values untouched, got %v", d["count"])
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Warn("busy", "error", e)
+	if !bytes.Contains(buf.Bytes(), []byte(`"region":"eu-west-1/b"`)) {
+		t.Errorf("expected Stringer rendered in logs, got %s", buf.String())
+	}
+
+	if _, ok := e.Details.(map[string]any)["region"].(region); !ok {
+		t.Error("normalizing should not mutate the error's details")
+	}
+}
@@ -0,0 +1,154 @@
+package errenvelope
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Envelope holds writer configuration for one server, so differently
+// configured servers can share a process (tests, multi-tenant hosts).
+// The zero value behaves like the package defaults; the package-level
+// functions (Write, TraceMiddleware, ...) use an Envelope built from the
+// package-level settings.
+//
+// Example:
+//
+//	env := &errenvelope.Envelope{
+//	    TraceHeader: "X-Trace-Id",
+//	    ContentType: "application/vnd.acme.error+json",
+//	}
+//	handler := env.TraceMiddleware(mux)
+//	// in handlers:
+//	env.Write(w, r, errenvelope.NotFound("User not found"))
+//
+// Configure an Envelope before serving requests and don't modify it after.
+//
+// Settings that apply when an error is built, mapped, or marshaled rather
+// than when it is written stay package-level and are shared by every
+// Envelope: ErrorIDGenerator, StrictMessages, OnDefaultMessage,
+// CanceledStatus, ExposeDownstreamCause, NameDownstreamService,
+// ServerID, ExposeServerID, and LogKeys.
+type Envelope struct {
+	// TraceHeader is the request/response header carrying the trace ID.
+	// Defaults to HeaderTraceID.
+	TraceHeader string
+
+	// ContentType is the media type of envelope bodies (see the
+	// package-level ContentType). Defaults to application/json.
+	ContentType string
+
+	// AlwaysArray wraps every envelope in an "errors" array (see the
+	// package-level AlwaysArray).
+	AlwaysArray bool
+
+	// StrictAccept answers 406 when the Accept header rules out every
+	// supported media type (see the package-level StrictAccept).
+	StrictAccept bool
+
+	// NegotiateProblem sends problem+json to clients that prefer it (see
+	// the package-level NegotiateProblem). Off by default.
+	NegotiateProblem bool
+
+	// TraceHeaderOrder lists the request headers read for a trace ID, in
+	// precedence order (see the package-level TraceHeaderOrder). Nil reads
+	// only TraceHeader.
+	TraceHeaderOrder []string
+
+	// TraceIDExtractor supplies a trace ID when the request has none in
+	// its header or context (see the package-level TraceIDExtractor).
+	TraceIDExtractor func(r *http.Request) string
+
+	// SpanIDExtractor supplies the span ID stamped on written errors (see
+	// the package-level SpanIDExtractor).
+	SpanIDExtractor func(r *http.Request) string
+
+	// SkipTrace exempts requests from TraceMiddleware (see the
+	// package-level SkipTrace).
+	SkipTrace func(r *http.Request) bool
+
+	// OmitTraceIDInBody keeps trace_id out of response bodies (see the
+	// package-level OmitTraceIDInBody).
+	OmitTraceIDInBody bool
+
+	// RetryableForMethod clears Retryable on errors for non-idempotent
+	// requests (see the package-level RetryableForMethod).
+	RetryableForMethod bool
+
+	// DocsBaseURL is the base of per-code documentation pages (see the
+	// package-level DocsBaseURL).
+	DocsBaseURL string
+
+	// TrustForwardedHeaders builds the problem instance from
+	// X-Forwarded-* headers (see the package-level TrustForwardedHeaders).
+	TrustForwardedHeaders bool
+
+	// DocsSlug maps a code to its page under DocsBaseURL (see the
+	// package-level DocsSlug).
+	DocsSlug func(code Code) string
+
+	// OnWriteError is called when a response can't be delivered (see the
+	// package-level OnWriteError).
+	OnWriteError func(r *http.Request, err error, clientGone bool)
+}
+
+// defaultEnvelope returns an Envelope mirroring the package-level settings.
+func defaultEnvelope() *Envelope {
+	return &Envelope{
+		TraceHeader:           HeaderTraceID,
+		ContentType:           ContentType,
+		AlwaysArray:           AlwaysArray,
+		StrictAccept:          StrictAccept,
+		NegotiateProblem:      NegotiateProblem,
+		TraceHeaderOrder:      TraceHeaderOrder,
+		TraceIDExtractor:      TraceIDExtractor,
+		SpanIDExtractor:       SpanIDExtractor,
+		SkipTrace:             SkipTrace,
+		OmitTraceIDInBody:     OmitTraceIDInBody,
+		DocsBaseURL:           DocsBaseURL,
+		DocsSlug:              DocsSlug,
+		OnWriteError:          OnWriteError,
+		RetryableForMethod:    RetryableForMethod,
+		TrustForwardedHeaders: TrustForwardedHeaders,
+	}
+}
+
+// From maps err into an *Error like the package-level From.
+func (env *Envelope) From(err error) *Error {
+	return From(err)
+}
+
+func (env *Envelope) traceHeader() string {
+	if env.TraceHeader == "" {
+		return HeaderTraceID
+	}
+	return env.TraceHeader
+}
+
+// helpURL returns the documentation URL for e: its own HelpURL, or one
+// derived from DocsBaseURL, or "" when neither is set.
+func (env *Envelope) helpURL(e *Error) string {
+	if e.HelpURL != "" {
+		return e.HelpURL
+	}
+	return env.docsURL(e.Code)
+}
+
+// docsURL returns the documentation page for code under DocsBaseURL, or
+// "" when DocsBaseURL is unset.
+func (env *Envelope) docsURL(code Code) string {
+	if env.DocsBaseURL == "" {
+		return ""
+	}
+	slug := codeSlug
+	if env.DocsSlug != nil {
+		slug = env.DocsSlug
+	}
+	return strings.TrimSuffix(env.DocsBaseURL, "/") + "/" + slug(code)
+}
+
+func (env *Envelope) contentType() string {
+	if env.ContentType == "" {
+		return ContentTypeJSON
+	}
+	return env.ContentType
+}
@@ -0,0 +1,126 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEnvelopeInstancesIndependent(t *testing.T) {
+	a := &Envelope{TraceHeader: "X-Trace-A"}
+	b := &Envelope{TraceHeader: "X-Trace-B", ContentType: "application/vnd.b.error+json", AlwaysArray: true}
+
+	serve := func(env *Envelope, header, id string) *httptest.ResponseRecorder {
+		handler := env.TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			env.Write(w, r, NotFound("missing"))
+		}))
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(header, id)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	wa := serve(a, "X-Trace-A", "trace-a")
+	wb := serve(b, "X-Trace-B", "trace-b")
+
+	if got := wa.Header().Get("X-Trace-A"); got != "trace-a" {
+		t.Errorf("expected instance A header trace-a, got %q", got)
+	}
+	if wa.Header().Get("X-Trace-B") != "" || wa.Header().Get(HeaderTraceID) != "" {
+		t.Error("instance A should only use its own header")
+	}
+	if got := wb.Header().Get("X-Trace-B"); got != "trace-b" {
+		t.Errorf("expected instance B header trace-b, got %q", got)
+	}
+
+	if ct := wa.Header().Get("Content-Type"); ct != ContentTypeJSON {
+		t.Errorf("expected instance A default content type, got %s", ct)
+	}
+	if ct := wb.Header().Get("Content-Type"); ct != "application/vnd.b.error+json" {
+		t.Errorf("expected instance B vendor content type, got %s", ct)
+	}
+
+	var single map[string]any
+	if err := json.Unmarshal(wa.Body.Bytes(), &single); err != nil || single["trace_id"] != "trace-a" {
+		t.Errorf("expected single envelope with trace-a, got %s", wa.Body.String())
+	}
+	var list errorList
+	if err := json.Unmarshal(wb.Body.Bytes(), &list); err != nil || len(list.Errors) != 1 || list.Errors[0].TraceID != "trace-b" {
+		t.Errorf("expected array envelope with trace-b, got %s", wb.Body.String())
+	}
+
+	// Package-level settings are untouched
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), NotFound("missing"))
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+		t.Errorf("expected package default content type, got %s", ct)
+	}
+}
+
+func TestEnvelopeZeroValue(t *testing.T) {
+	var env Envelope
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(HeaderTraceID, "trace-zero")
+	w := httptest.NewRecorder()
+	env.Write(w, r, Unauthorized(""))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", w.Code)
+	}
+	if got := w.Header().Get(HeaderTraceID); got != "trace-zero" {
+		t.Errorf("expected default trace header, got %q", got)
+	}
+	if id := env.TraceIDFromRequest(r); id != "trace-zero" {
+		t.Errorf("expected trace ID from default header, got %q", id)
+	}
+}
+
+func TestEnvelopeOnWriteError(t *testing.T) {
+	var reported bool
+	env := &Envelope{OnWriteError: func(*http.Request, error, bool) { reported = true }}
+
+	env.Write(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil),
+		Internal("x").WithDetails(map[string]any{"f": func() {}}))
+	if !reported {
+		t.Error("expected instance hook to be called")
+	}
+}
+
+func TestEnvelopeMiddlewareUsesInstance(t *testing.T) {
+	env := &Envelope{TraceHeader: "X-Trace-Id", AlwaysArray: true}
+
+	tests := map[string]http.Handler{
+		"recover": env.RecoverMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+			panic("boom")
+		})),
+		"timeout": env.TimeoutMiddleware(time.Nanosecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})),
+		"hop limit": http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set(HeaderRequestHops, "1")
+			env.HopLimitMiddleware(1)(http.NotFoundHandler()).ServeHTTP(w, r)
+		}),
+		"envelope response": env.EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", http.StatusForbidden)
+		})),
+	}
+	for name, h := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("X-Trace-Id", "trace-env")
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if got := w.Header().Get("X-Trace-Id"); got != "trace-env" {
+				t.Errorf("expected the instance trace header, got %q", got)
+			}
+			var list errorList
+			if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil || len(list.Errors) != 1 {
+				t.Errorf("expected an AlwaysArray body, got %s", w.Body.String())
+			}
+		})
+	}
+}
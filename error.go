@@ -6,26 +6,46 @@
 package errenvelope
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"runtime/debug"
+	"sync"
 	"time"
 )
 
 // Error is a structured error envelope for HTTP APIs.
+//
+// Layout: serialized fields come first, in JSON key order, since moving
+// them changes the wire output. The fields Write reads for every response
+// (Status, RetryAfter, RetryAt, Headers) follow, and log-only fields come
+// last. An Error is copied by every With* call and every Write, so it is
+// held to a size budget (maxErrorSize in the tests, four 64-byte cache
+// lines on 64-bit platforms); prefer Details, or a pointer to a rarely
+// used struct, over new inline fields.
 type Error struct {
 	Code      Code   `json:"code"`
+	Subcode   string `json:"subcode,omitempty"`
 	Message   string `json:"message"`
+	Hint      string `json:"hint,omitempty"`
+	HelpURL   string `json:"help_url,omitempty"`
 	Details   any    `json:"details,omitempty"`
 	TraceID   string `json:"trace_id,omitempty"`
+	SpanID    string `json:"span_id,omitempty"`
+	ErrorID   string `json:"error_id,omitempty"`
 	Retryable bool   `json:"retryable"`
+	Transient bool   `json:"transient,omitempty"`
 
 	// Not serialized:
 	Status     int           `json:"-"`
-	Cause      error         `json:"-"`
 	RetryAfter time.Duration `json:"-"` // Duration to wait before retrying
+	RetryAt    time.Time     `json:"-"` // Absolute retry time; takes precedence over RetryAfter
+	Headers    http.Header   `json:"-"` // Extra response headers set by Write
+	Cause      error         `json:"-"`
+	Stack      []byte        `json:"-"` // Goroutine stack captured by WithStack; for logs only
 }
 
 func (e *Error) Error() string {
@@ -40,37 +60,186 @@ func (e *Error) Error() string {
 
 func (e *Error) Unwrap() error { return e.Cause }
 
+// Is reports whether target is an *Error with the same code.
+// This lets errors.Is match against the sentinel values (ErrNotFound, etc.).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || e == nil || t == nil {
+		return false
+	}
+	return e.Code == t.Code
+}
+
 // MarshalJSON implements custom JSON serialization to include retry_after as a human-readable string.
 // When RetryAfter is set, it appears in the JSON response as "retry_after": "30s" or "5m0s".
+// When RetryAt is set it wins: retry_after is the time remaining until then (see retryDelay).
+// Error and fmt.Stringer values in map details are rendered as strings (see normalizeDetails).
 func (e *Error) MarshalJSON() ([]byte, error) {
 	type Alias Error
+	c := *e
+	c.Details = normalizeDetails(e.Details)
 	aux := &struct {
 		*Alias
 		RetryAfterStr string `json:"retry_after,omitempty"`
+		ServerID      string `json:"server_id,omitempty"`
 	}{
-		Alias: (*Alias)(e),
+		Alias: (*Alias)(&c),
+	}
+	if d := e.retryDelay(); d > 0 {
+		aux.RetryAfterStr = d.String()
 	}
-	if e.RetryAfter > 0 {
-		aux.RetryAfterStr = e.RetryAfter.String()
+	if ExposeServerID {
+		aux.ServerID = ServerID
 	}
 	return json.Marshal(aux)
 }
 
+// UnmarshalJSON decodes an envelope, parsing retry_after back into RetryAfter.
+// Status is not part of the body; Parse sets it from the response.
+//
+// The input is untrusted: anything but a JSON object (or null, a no-op)
+// is rejected, as is a retry_after that is negative or out of range. On
+// error e is left unchanged, never partially populated.
+func (e *Error) UnmarshalJSON(data []byte) error {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.Equal(trimmed, []byte("null")) {
+		return nil
+	}
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return errors.New("errenvelope: envelope is not a JSON object")
+	}
+
+	type Alias Error
+	var decoded Error
+	aux := &struct {
+		*Alias
+		RetryAfterStr string `json:"retry_after,omitempty"`
+	}{
+		Alias: (*Alias)(&decoded),
+	}
+	if err := json.Unmarshal(data, aux); err != nil {
+		return err
+	}
+	if aux.RetryAfterStr != "" {
+		d, err := time.ParseDuration(aux.RetryAfterStr)
+		if err != nil {
+			return fmt.Errorf("errenvelope: invalid retry_after %q: %w", aux.RetryAfterStr, err)
+		}
+		if d < 0 {
+			return fmt.Errorf("errenvelope: invalid retry_after %q: negative duration", aux.RetryAfterStr)
+		}
+		decoded.RetryAfter = d
+	}
+	*e = decoded
+	return nil
+}
+
+// now is the clock used for RetryAt; tests replace it.
+var now = time.Now
+
+// retryDelay returns the retry hint to send, or 0 for none.
+// If RetryAt is set it takes precedence: the remaining time is rounded up
+// to whole seconds and clamped at zero, so a passed RetryAt sends no hint.
+// Otherwise RetryAfter is used as-is.
+func (e *Error) retryDelay() time.Duration {
+	if e.RetryAt.IsZero() {
+		return e.RetryAfter
+	}
+	d := e.RetryAt.Sub(now())
+	if d <= 0 {
+		return 0
+	}
+	if rem := d % time.Second; rem != 0 {
+		d += time.Second - rem
+	}
+	return d
+}
+
+// ErrorIDGenerator produces the per-error ID assigned by New.
+// Unlike the trace ID, which identifies a request across services, the
+// error ID identifies one error occurrence for exact log lookup and is
+// never propagated across hops. Defaults to a random 16-byte hex string.
+// Set to nil to disable error IDs. Set once at startup.
+var ErrorIDGenerator = newTraceID
+
+// defaultRetryAfter holds per-code RetryAfter defaults applied by New.
+var (
+	retryAfterMu      sync.RWMutex
+	defaultRetryAfter = map[Code]time.Duration{}
+)
+
+func defaultRetryAfterFor(code Code) time.Duration {
+	retryAfterMu.RLock()
+	defer retryAfterMu.RUnlock()
+	return defaultRetryAfter[code]
+}
+
+// SetDefaultRetryAfter configures a RetryAfter applied to every new error
+// with the given code, e.g. so RateLimited("x") always carries a 5s hint.
+// An explicit WithRetryAfter overrides it. A duration <= 0 removes the
+// default. Call at startup, before serving requests; it is safe to call
+// concurrently with New.
+func SetDefaultRetryAfter(code Code, d time.Duration) {
+	retryAfterMu.Lock()
+	defer retryAfterMu.Unlock()
+	if d <= 0 {
+		delete(defaultRetryAfter, code)
+		return
+	}
+	defaultRetryAfter[code] = d
+}
+
+// StrictMessages makes New and From report every message that falls back
+// to the code's default via OnDefaultMessage, so unhandled paths surface
+// in staging. The response is unchanged. Set once at startup.
+var StrictMessages bool
+
+// OnDefaultMessage is called in strict mode when an error's message
+// defaults. Defaults to a slog warning carrying the code.
+// Set once at startup.
+var OnDefaultMessage = func(code Code) {
+	slog.Warn("errenvelope: error has no message, using the default", "code", code)
+}
+
+// defaultMessageFor returns the default message for an error with code
+// and status, reporting it in strict mode. Codes without a message of
+// their own (neither built in nor registered) use the status text, e.g.
+// "I'm a teapot" for 418, rather than "Internal error".
+func defaultMessageFor(code Code, status int) string {
+	if StrictMessages && OnDefaultMessage != nil {
+		OnDefaultMessage(code)
+	}
+	if _, registered := lookupCode(code); !registered && !isBuiltinCode(code) {
+		if text := http.StatusText(status); text != "" {
+			return text
+		}
+	}
+	return defaultMessage(code)
+}
+
 // New creates a new Error with the given code, HTTP status, and message.
 // If status is 0, defaults to 500. If message is empty, uses a default.
+// A fresh ErrorID is assigned via ErrorIDGenerator, and RetryAfter
+// defaults to any value configured with SetDefaultRetryAfter.
 func New(code Code, status int, msg string) *Error {
 	if status == 0 {
 		status = http.StatusInternalServerError
 	}
 	if msg == "" {
-		msg = defaultMessage(code)
+		msg = defaultMessageFor(code, status)
+	}
+	e := &Error{
+		Code:       code,
+		Message:    msg,
+		Status:     status,
+		Retryable:  isRetryableDefault(code),
+		Transient:  isTransientDefault(code),
+		RetryAfter: defaultRetryAfterFor(code),
 	}
-	return &Error{
-		Code:      code,
-		Message:   msg,
-		Status:    status,
-		Retryable: isRetryableDefault(code),
+	if ErrorIDGenerator != nil {
+		e.ErrorID = ErrorIDGenerator()
 	}
+	return e
 }
 
 // Wrap creates a new Error that wraps an underlying cause.
@@ -100,6 +269,73 @@ func (e *Error) WithDetails(details any) *Error {
 	return &clone
 }
 
+// Category returns the dashboard group of the error's code.
+// See Code.Category.
+func (e *Error) Category() Category {
+	if e == nil {
+		return ""
+	}
+	return e.Code.Category()
+}
+
+// WithMessage overrides the message, keeping code, status, and details.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithMessage(msg string) *Error {
+	clone := *e
+	clone.Message = msg
+	return &clone
+}
+
+// WithMessagef overrides the message with a formatted one.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithMessagef(format string, args ...any) *Error {
+	return e.WithMessage(fmt.Sprintf(format, args...))
+}
+
+// WithHint adds human remediation guidance, e.g. "Verify the Authorization
+// header uses the Bearer scheme." Keep the message a summary of what went
+// wrong and the hint what to do about it.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithHint(hint string) *Error {
+	clone := *e
+	clone.Hint = hint
+	return &clone
+}
+
+// WithSubcode refines the code with a more specific, stable identifier,
+// e.g. "SCHEMA_MISMATCH" under VALIDATION_FAILED. Clients that only know
+// the code keep working; IsSubcode matches both.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithSubcode(subcode string) *Error {
+	clone := *e
+	clone.Subcode = subcode
+	return &clone
+}
+
+// WithHelpURL links the error to its documentation. Write sends it as
+// help_url and a Link header with rel="help". Without one, Write derives
+// a URL from DocsBaseURL when that is set.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithHelpURL(url string) *Error {
+	clone := *e
+	clone.HelpURL = url
+	return &clone
+}
+
+// WithHeader adds a response header that Write sets along with the
+// envelope, e.g. Content-Location. The trace, Retry-After, Link, and
+// Content-Type headers Write manages take precedence.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithHeader(key, value string) *Error {
+	clone := *e
+	clone.Headers = e.Headers.Clone()
+	if clone.Headers == nil {
+		clone.Headers = make(http.Header)
+	}
+	clone.Headers.Set(key, value)
+	return &clone
+}
+
 // WithTraceID adds a trace ID for distributed tracing.
 // Returns a copy to avoid mutating shared error instances.
 func (e *Error) WithTraceID(id string) *Error {
@@ -108,6 +344,26 @@ func (e *Error) WithTraceID(id string) *Error {
 	return &clone
 }
 
+// WithSpanID adds the ID of the tracing span the error occurred in, so
+// log tooling can link to the exact span as well as the trace.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithSpanID(id string) *Error {
+	clone := *e
+	clone.SpanID = id
+	return &clone
+}
+
+// WithTransient sets whether the condition is expected to resolve on its
+// own. Unlike Retryable ("safe to retry"), Transient says a retry will
+// likely succeed later: a 503 is both, while a retryable 409 may never
+// succeed without a change on the client's side.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithTransient(v bool) *Error {
+	clone := *e
+	clone.Transient = v
+	return &clone
+}
+
 // WithRetryable sets whether the error is retryable.
 // Returns a copy to avoid mutating shared error instances.
 func (e *Error) WithRetryable(v bool) *Error {
@@ -116,6 +372,20 @@ func (e *Error) WithRetryable(v bool) *Error {
 	return &clone
 }
 
+// EffectiveStatus returns the HTTP status Write sends for e: its Status,
+// or 500 when Status is unset. Middleware can use it before writing, e.g.
+// to pick a log level. A nil e reports 204 No Content, as Write sends for
+// a nil error.
+func (e *Error) EffectiveStatus() int {
+	if e == nil {
+		return http.StatusNoContent
+	}
+	if e.Status == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Status
+}
+
 // WithStatus overrides the HTTP status code.
 // Returns a copy to avoid mutating shared error instances.
 func (e *Error) WithStatus(status int) *Error {
@@ -127,7 +397,8 @@ func (e *Error) WithStatus(status int) *Error {
 }
 
 // WithRetryAfter sets the retry-after duration for rate-limited responses.
-// The duration will be sent as a Retry-After header (in seconds).
+// The duration will be sent as a Retry-After header, rounded up to whole
+// seconds, and precisely (e.g. "250ms") as retry_after in the body.
 // Returns a copy to avoid mutating shared error instances.
 func (e *Error) WithRetryAfter(d time.Duration) *Error {
 	clone := *e
@@ -135,32 +406,201 @@ func (e *Error) WithRetryAfter(d time.Duration) *Error {
 	return &clone
 }
 
+// WithRetryAt sets an absolute time after which the client may retry, e.g.
+// the end of a maintenance window. It takes precedence over RetryAfter;
+// the header and body carry the time remaining when the response is written.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithRetryAt(t time.Time) *Error {
+	clone := *e
+	clone.RetryAt = t
+	return &clone
+}
+
+// WithStack records the current goroutine's stack trace in Stack, for
+// logging. The stack is never sent to clients.
+// Returns a copy to avoid mutating shared error instances.
+func (e *Error) WithStack() *Error {
+	clone := *e
+	clone.Stack = debug.Stack()
+	return &clone
+}
+
+// Child creates a new error for a sub-failure of the same request, e.g.
+// one item of a batch before aggregating with Multi. It inherits e's
+// TraceID and SpanID but gets its own code, message, and error ID; the
+// status comes from the code (see StatusForCode).
+func (e *Error) Child(code Code, msg string) *Error {
+	c := New(code, StatusForCode(code), msg)
+	if e != nil {
+		c.TraceID = e.TraceID
+		c.SpanID = e.SpanID
+	}
+	return c
+}
+
+// Public returns a copy that is safe to send past a public network
+// boundary. For server errors (5xx, or an unset status) the message is
+// replaced with the code's generic default and Details, Hint, and Cause
+// are dropped; Code, Status, TraceID, ErrorID, and the retry signals are
+// kept so clients and support can still correlate the failure. Subcode,
+// HelpURL, and Headers are kept too, so don't put internals in them.
+// Client errors (4xx) are returned unchanged.
+func (e *Error) Public() *Error {
+	if e == nil || (e.Status != 0 && e.Status < 500) {
+		return e
+	}
+	clone := *e
+	clone.Message = defaultMessageFor(e.Code, e.EffectiveStatus())
+	clone.Details = nil
+	clone.Hint = ""
+	clone.Cause = nil
+	return &clone
+}
+
+// LogKeyNames holds the attribute keys LogValue emits.
+// An empty key omits that attribute.
+type LogKeyNames struct {
+	Code          string
+	Subcode       string
+	Message       string
+	Status        string
+	Retryable     string
+	Transient     string
+	Category      string
+	Severity      string
+	Hint          string
+	TraceID       string
+	SpanID        string
+	ErrorID       string
+	Details       string
+	TimeoutSource string
+	RetryAfter    string
+	RetryAt       string
+	RetryPolicy   string
+	Cause         string
+	ServerID      string
+}
+
+// ServerID identifies the build and instance producing errors, e.g.
+// "v1.8.2-canary/pod-7f9c", so errors from a canary can be told apart
+// from stable ones. LogValue includes it as server_id when set; bodies
+// include it only with ExposeServerID. Set once at startup.
+var ServerID string
+
+// ExposeServerID adds ServerID to envelope and problem bodies as
+// server_id. Build and host names help attackers, so enable it only for
+// internal services. Off by default. Set once at startup.
+var ExposeServerID bool
+
+// LogKeys are the attribute keys used by LogValue, so the envelope can
+// match an existing log taxonomy:
+//
+//	errenvelope.LogKeys.Code = "error.code"
+//	errenvelope.LogKeys.TraceID = "trace.id"
+//
+// Set once at startup.
+var LogKeys = LogKeyNames{
+	Code:          "code",
+	Subcode:       "subcode",
+	Message:       "message",
+	Status:        "status",
+	Retryable:     "retryable",
+	Transient:     "transient",
+	Category:      "category",
+	Severity:      "severity",
+	Hint:          "hint",
+	TraceID:       "trace_id",
+	SpanID:        "span_id",
+	ErrorID:       "error_id",
+	Details:       "details",
+	TimeoutSource: "timeout_source",
+	RetryAfter:    "retry_after",
+	RetryAt:       "retry_at",
+	RetryPolicy:   "retry_policy",
+	Cause:         "cause",
+	ServerID:      "server_id",
+}
+
 // LogValue implements slog.LogValuer for structured logging.
+// Attribute keys come from LogKeys.
 func (e *Error) LogValue() slog.Value {
 	if e == nil {
 		return slog.GroupValue()
 	}
-	attrs := []slog.Attr{
-		slog.String("code", string(e.Code)),
-		slog.String("message", e.Message),
-		slog.Int("status", e.Status),
-		slog.Bool("retryable", e.Retryable),
+	keys := LogKeys
+	attrs := make([]slog.Attr, 0, 8)
+	add := func(key string, v slog.Value) {
+		if key != "" {
+			attrs = append(attrs, slog.Attr{Key: key, Value: v})
+		}
+	}
+
+	add(keys.Code, slog.StringValue(string(e.Code)))
+	if e.Subcode != "" {
+		add(keys.Subcode, slog.StringValue(e.Subcode))
+	}
+	add(keys.Message, slog.StringValue(e.Message))
+	add(keys.Status, slog.IntValue(e.Status))
+	add(keys.Retryable, slog.BoolValue(e.Retryable))
+	add(keys.Transient, slog.BoolValue(e.Transient))
+	add(keys.Category, slog.StringValue(e.Category().String()))
+	add(keys.Severity, slog.StringValue(e.Severity().String()))
+	if e.Hint != "" {
+		add(keys.Hint, slog.StringValue(e.Hint))
 	}
 	if e.TraceID != "" {
-		attrs = append(attrs, slog.String("trace_id", e.TraceID))
+		add(keys.TraceID, slog.StringValue(e.TraceID))
+	}
+	if e.SpanID != "" {
+		add(keys.SpanID, slog.StringValue(e.SpanID))
+	}
+	if e.ErrorID != "" {
+		add(keys.ErrorID, slog.StringValue(e.ErrorID))
+	}
+	policy, hasPolicy := e.RetryPolicy()
+	details := e.Details
+	if hasPolicy {
+		// Logged once, as its own attribute below
+		details = withoutDetail(details, "retry_policy")
+	}
+	if details != nil {
+		add(keys.Details, slog.AnyValue(normalizeDetails(details)))
+	}
+	if src := timeoutSource(e); src != "" {
+		add(keys.TimeoutSource, slog.StringValue(string(src)))
 	}
-	if e.Details != nil {
-		attrs = append(attrs, slog.Any("details", e.Details))
+	if d := e.retryDelay(); d > 0 {
+		add(keys.RetryAfter, slog.DurationValue(d))
 	}
-	if e.RetryAfter > 0 {
-		attrs = append(attrs, slog.Duration("retry_after", e.RetryAfter))
+	if !e.RetryAt.IsZero() {
+		add(keys.RetryAt, slog.TimeValue(e.RetryAt))
+	}
+	if hasPolicy {
+		add(keys.RetryPolicy, slog.GroupValue(
+			slog.Int("max_attempts", policy.MaxAttempts),
+			slog.Duration("backoff", policy.Backoff),
+		))
 	}
 	if e.Cause != nil {
-		attrs = append(attrs, slog.String("cause", e.Cause.Error()))
+		add(keys.Cause, slog.StringValue(e.Cause.Error()))
+	}
+	if ServerID != "" {
+		add(keys.ServerID, slog.StringValue(ServerID))
 	}
 	return slog.GroupValue(attrs...)
 }
 
+// LogGroup returns the error's log attributes as a group named name,
+// for control over nesting. slog.Any("error", e) and LogGroup("error")
+// log the same thing; LogGroup("err") picks another group name, and
+// LogGroup("") inlines the attributes at the top level of the record:
+//
+//	logger.Error("request failed", e.LogGroup(""))
+//	// {"msg":"request failed","code":"NOT_FOUND","message":"..."}
+func (e *Error) LogGroup(name string) slog.Attr {
+	return slog.Attr{Key: name, Value: e.LogValue()}
+}
+
 // Is checks if an error has the given code.
 func Is(err error, code Code) bool {
 	var e *Error
@@ -170,6 +610,16 @@ func Is(err error, code Code) bool {
 	return false
 }
 
+// IsSubcode checks if an error has both the given code and subcode, e.g.
+// IsSubcode(err, CodeValidationFailed, "SCHEMA_MISMATCH").
+func IsSubcode(err error, code Code, subcode string) bool {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code == code && e.Subcode == subcode
+	}
+	return false
+}
+
 func defaultMessage(code Code) string {
 	switch code {
 	case CodeBadRequest:
@@ -182,10 +632,14 @@ func defaultMessage(code Code) string {
 		return "Forbidden"
 	case CodeNotFound:
 		return "Not found"
+	case CodeNotAcceptable:
+		return "Not acceptable"
 	case CodeGone:
 		return "Resource no longer exists"
 	case CodeConflict:
 		return "Conflict"
+	case CodeLengthRequired:
+		return "Length required"
 	case CodePayloadTooLarge:
 		return "Payload too large"
 	case CodeUnprocessableEntity:
@@ -200,16 +654,27 @@ func defaultMessage(code Code) string {
 		return "Request canceled"
 	case CodeDownstream:
 		return "Downstream service error"
-	default:
-		return "Internal error"
 	}
+	if info, ok := lookupCode(code); ok && info.Message != "" {
+		return info.Message
+	}
+	return "Internal error"
 }
 
 func isRetryableDefault(code Code) bool {
 	switch code {
 	case CodeTimeout, CodeDownstreamTimeout, CodeUnavailable, CodeRateLimited:
 		return true
-	default:
-		return false
 	}
+	info, _ := lookupCode(code)
+	return info.Retryable
+}
+
+func isTransientDefault(code Code) bool {
+	switch code {
+	case CodeRequestTimeout, CodeTimeout, CodeDownstream, CodeDownstreamTimeout, CodeUnavailable, CodeRateLimited:
+		return true
+	}
+	info, _ := lookupCode(code)
+	return info.Transient
 }
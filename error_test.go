@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"testing"
 	"time"
+	"unsafe"
 )
 
 func TestNew(t *testing.T) {
@@ -419,3 +421,384 @@ func TestFormattedHelpers(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorID(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		e := NotFound("missing")
+		if e.ErrorID == "" {
+			t.Fatal("expected error ID to be generated")
+		}
+		if seen[e.ErrorID] {
+			t.Fatalf("duplicate error ID %s", e.ErrorID)
+		}
+		seen[e.ErrorID] = true
+	}
+
+	// Copies keep the ID: they describe the same occurrence
+	e := Internal("boom")
+	if c := e.WithTraceID("trace-1"); c.ErrorID != e.ErrorID {
+		t.Error("expected With* copy to keep the error ID")
+	}
+
+	// Present in JSON and logs
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+	var result map[string]any
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+	if result["error_id"] != e.ErrorID {
+		t.Errorf("expected error_id %s in JSON, got %v", e.ErrorID, result["error_id"])
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", "error", e)
+	if !bytes.Contains(buf.Bytes(), []byte(`"error_id":"`+e.ErrorID+`"`)) {
+		t.Errorf("expected error_id in log output, got %s", buf.String())
+	}
+
+	// Sentinels are shared and carry no ID
+	if ErrNotFound.ErrorID != "" {
+		t.Error("expected sentinel to have no error ID")
+	}
+}
+
+func TestErrorIDGenerator(t *testing.T) {
+	ErrorIDGenerator = func() string { return "err-fixed" }
+	t.Cleanup(func() { ErrorIDGenerator = newTraceID })
+
+	if id := BadRequest("bad").ErrorID; id != "err-fixed" {
+		t.Errorf("expected custom error ID, got %s", id)
+	}
+
+	ErrorIDGenerator = nil
+	e := BadRequest("bad")
+	if e.ErrorID != "" {
+		t.Errorf("expected no error ID when generator is nil, got %s", e.ErrorID)
+	}
+	data, _ := json.Marshal(e)
+	if bytes.Contains(data, []byte("error_id")) {
+		t.Errorf("expected error_id to be omitted, got %s", data)
+	}
+}
+
+func TestWithHint(t *testing.T) {
+	original := Unauthorized("Invalid token")
+	e := original.WithHint("Verify the Authorization header uses the Bearer scheme.")
+
+	if original.Hint != "" {
+		t.Error("WithHint should not mutate the original")
+	}
+
+	data, _ := json.Marshal(e)
+	var m map[string]any
+	_ = json.Unmarshal(data, &m)
+	if m["hint"] != "Verify the Authorization header uses the Bearer scheme." {
+		t.Errorf("expected hint in JSON, got %s", data)
+	}
+	if m["message"] != "Invalid token" {
+		t.Errorf("expected message unchanged, got %v", m["message"])
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", "error", e)
+	if !bytes.Contains(buf.Bytes(), []byte(`"hint":"Verify the Authorization`)) {
+		t.Errorf("expected hint in log output, got %s", buf.String())
+	}
+
+	// Omitted when unset
+	data, _ = json.Marshal(original)
+	if bytes.Contains(data, []byte("hint")) {
+		t.Errorf("expected hint to be omitted, got %s", data)
+	}
+}
+
+func TestWithMessage(t *testing.T) {
+	original := NotFound("")
+	e := original.WithMessage("User not found")
+
+	if e.Message != "User not found" {
+		t.Errorf("expected message 'User not found', got %s", e.Message)
+	}
+	if e.Code != CodeNotFound || e.Status != http.StatusNotFound {
+		t.Errorf("expected code/status preserved, got %s/%d", e.Code, e.Status)
+	}
+	if original.Message != "Not found" {
+		t.Errorf("WithMessage should not mutate the original, got %s", original.Message)
+	}
+
+	f := original.WithMessagef("user %s not found", "u_42")
+	if f.Message != "user u_42 not found" {
+		t.Errorf("expected formatted message, got %s", f.Message)
+	}
+	if f.Code != CodeNotFound || f.Status != http.StatusNotFound {
+		t.Errorf("expected code/status preserved, got %s/%d", f.Code, f.Status)
+	}
+}
+
+func TestPublic(t *testing.T) {
+	internal := Wrap(CodeInternal, http.StatusInternalServerError, "pq: relation users_v2 does not exist", errors.New("sql error")).
+		WithDetails(map[string]any{"query": "SELECT * FROM users_v2"}).
+		WithHint("Run migration 42").
+		WithTraceID("trace-1")
+
+	pub := internal.Public()
+	if pub.Message != "Internal error" {
+		t.Errorf("expected generic message, got %s", pub.Message)
+	}
+	if pub.Details != nil || pub.Cause != nil || pub.Hint != "" {
+		t.Errorf("expected details, hint, and cause dropped, got %+v", pub)
+	}
+	if pub.Code != CodeInternal || pub.Status != http.StatusInternalServerError || pub.TraceID != "trace-1" {
+		t.Errorf("expected code/status/trace preserved, got %s/%d/%s", pub.Code, pub.Status, pub.TraceID)
+	}
+	if internal.Details == nil || internal.Message != "pq: relation users_v2 does not exist" {
+		t.Error("Public should not mutate the original")
+	}
+	data, _ := json.Marshal(pub)
+	if bytes.Contains(data, []byte("users_v2")) {
+		t.Errorf("sensitive data leaked: %s", data)
+	}
+
+	client := BadRequest("Missing name").WithDetails(map[string]any{"field": "name"})
+	if got := client.Public(); got != client {
+		t.Error("expected client errors to pass through unchanged")
+	}
+
+	if (*Error)(nil).Public() != nil {
+		t.Error("expected nil for nil error")
+	}
+}
+
+func TestPublicCustomCode(t *testing.T) {
+	e := New(Code("LEGACY_BACKEND_DOWN"), http.StatusServiceUnavailable, "mainframe at 10.0.0.7 refused")
+	if pub := e.Public(); pub.Message != "Service Unavailable" {
+		t.Errorf("expected status text for an unregistered code, got %q", pub.Message)
+	}
+}
+
+func TestLogKeys(t *testing.T) {
+	prev := LogKeys
+	t.Cleanup(func() { LogKeys = prev })
+	LogKeys.Code = "error.code"
+	LogKeys.Message = "error.message"
+	LogKeys.TraceID = "trace.id"
+	LogKeys.Status = ""
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", "error", NotFound("missing").WithTraceID("t-1"))
+
+	var entry struct {
+		Error map[string]any `json:"error"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log output: %v", err)
+	}
+	if entry.Error["error.code"] != "NOT_FOUND" || entry.Error["error.message"] != "missing" || entry.Error["trace.id"] != "t-1" {
+		t.Errorf("expected renamed keys, got %v", entry.Error)
+	}
+	if _, ok := entry.Error["code"]; ok {
+		t.Error("expected default code key to be replaced")
+	}
+	if _, ok := entry.Error["status"]; ok {
+		t.Error("expected empty key to omit status")
+	}
+	if entry.Error["retryable"] != false {
+		t.Errorf("expected unchanged keys to keep defaults, got %v", entry.Error)
+	}
+}
+
+func TestLogValueCategory(t *testing.T) {
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", "error", Forbidden("no"))
+	if !bytes.Contains(buf.Bytes(), []byte(`"category":"auth"`)) {
+		t.Errorf("expected category in log output, got %s", buf.String())
+	}
+}
+
+func TestLogGroup(t *testing.T) {
+	e := NotFound("missing").WithTraceID("t-1")
+
+	attr := e.LogGroup("err")
+	if attr.Key != "err" || attr.Value.Kind() != slog.KindGroup {
+		t.Fatalf("expected group named err, got %q (%v)", attr.Key, attr.Value.Kind())
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", e.LogGroup(""))
+	var entry map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid log output: %v", err)
+	}
+	if entry["code"] != "NOT_FOUND" || entry["trace_id"] != "t-1" {
+		t.Errorf("expected attributes at the top level, got %v", entry)
+	}
+
+	if attr := (*Error)(nil).LogGroup("error"); attr.Key != "error" || len(attr.Value.Group()) != 0 {
+		t.Errorf("expected empty group for nil error, got %v", attr)
+	}
+}
+
+func TestStrictMessages(t *testing.T) {
+	prevHook := OnDefaultMessage
+	t.Cleanup(func() {
+		StrictMessages = false
+		OnDefaultMessage = prevHook
+	})
+	var reported []Code
+	OnDefaultMessage = func(code Code) { reported = append(reported, code) }
+
+	// Off by default
+	NotFound("")
+	if len(reported) != 0 {
+		t.Fatalf("expected no reports with strict mode off, got %v", reported)
+	}
+
+	StrictMessages = true
+	e := NotFound("")
+	if e.Message != "Not found" {
+		t.Errorf("expected the response message unchanged, got %q", e.Message)
+	}
+	From(&Error{Code: CodeConflict, Status: http.StatusConflict})
+	NotFound("User not found")
+	if len(reported) != 2 || reported[0] != CodeNotFound || reported[1] != CodeConflict {
+		t.Errorf("expected reports for defaulted messages only, got %v", reported)
+	}
+}
+
+func TestIsSubcode(t *testing.T) {
+	e := Validation(FieldErrors{"body": "unknown field"}).WithSubcode("SCHEMA_MISMATCH")
+	wrapped := fmt.Errorf("decode: %w", e)
+
+	if !IsSubcode(wrapped, CodeValidationFailed, "SCHEMA_MISMATCH") {
+		t.Error("expected code and subcode to match")
+	}
+	if IsSubcode(wrapped, CodeBadRequest, "SCHEMA_MISMATCH") {
+		t.Error("expected a different code not to match")
+	}
+	if IsSubcode(wrapped, CodeValidationFailed, "MISSING_FIELD") {
+		t.Error("expected a different subcode not to match")
+	}
+	if IsSubcode(Validation(nil), CodeValidationFailed, "SCHEMA_MISMATCH") {
+		t.Error("expected an error without a subcode not to match")
+	}
+	if IsSubcode(errors.New("plain"), CodeInternal, "") {
+		t.Error("expected a non-envelope error not to match")
+	}
+	if !Is(wrapped, CodeValidationFailed) {
+		t.Error("expected Is to ignore the subcode")
+	}
+
+	data, _ := json.Marshal(e)
+	if !bytes.Contains(data, []byte(`"subcode":"SCHEMA_MISMATCH"`)) {
+		t.Errorf("expected subcode in JSON, got %s", data)
+	}
+}
+
+// maxErrorSize is the size budget for Error: four 64-byte cache lines on
+// 64-bit platforms. Raising it should be a deliberate decision; see the
+// layout notes on Error.
+const maxErrorSize = 256
+
+func TestErrorSize(t *testing.T) {
+	if size := unsafe.Sizeof(Error{}); size > maxErrorSize {
+		t.Errorf("Error is %d bytes, over the %d-byte budget; move rarely used fields out of line", size, maxErrorSize)
+	}
+
+	// The fields read on every write stay ahead of the log-only ones
+	var e Error
+	if unsafe.Offsetof(e.Status) > unsafe.Offsetof(e.Cause) || unsafe.Offsetof(e.Headers) > unsafe.Offsetof(e.Cause) {
+		t.Error("expected write-path fields before log-only fields")
+	}
+}
+
+func BenchmarkNew(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = New(CodeNotFound, http.StatusNotFound, "user not found")
+	}
+}
+
+func BenchmarkMarshalJSON(b *testing.B) {
+	e := RateLimited("slow down").
+		WithTraceID("trace-bench").
+		WithRetryAfter(30 * time.Second).
+		WithDetails(map[string]any{"limit": 100})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := json.Marshal(e); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLogValue(b *testing.B) {
+	e := Unavailable("billing down").
+		WithTraceID("trace-bench").
+		WithDetails(map[string]any{"service": "billing"})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_ = e.LogValue()
+	}
+}
+
+func TestChild(t *testing.T) {
+	parent := Internal("batch failed").WithTraceID("trace-batch").WithSpanID("span-1")
+	child := parent.Child(CodeNotFound, "item 3 not found")
+
+	if child.TraceID != "trace-batch" || child.SpanID != "span-1" {
+		t.Errorf("expected the parent's trace and span IDs, got %q %q", child.TraceID, child.SpanID)
+	}
+	if child.Code != CodeNotFound || child.Message != "item 3 not found" || child.Status != http.StatusNotFound {
+		t.Errorf("expected the child's own code, message, and status, got %+v", child)
+	}
+	if child.ErrorID == "" || child.ErrorID == parent.ErrorID {
+		t.Errorf("expected a distinct error ID, got %q (parent %q)", child.ErrorID, parent.ErrorID)
+	}
+	if parent.Code != CodeInternal || parent.Message != "batch failed" {
+		t.Error("expected the parent unchanged")
+	}
+
+	m := Multi(parent.Child(CodeConflict, "a"), parent.Child(CodeConflict, "b"))
+	for _, c := range m.Details.(map[string]any)["errors"].([]*Error) {
+		if c.TraceID != "trace-batch" {
+			t.Errorf("expected aggregated children to share the trace ID, got %q", c.TraceID)
+		}
+	}
+}
+
+func TestServerID(t *testing.T) {
+	ServerID = "v1.8.2-canary/pod-7f9c"
+	t.Cleanup(func() {
+		ServerID = ""
+		ExposeServerID = false
+	})
+
+	var found bool
+	for _, a := range Internal("boom").LogValue().Group() {
+		if a.Key == "server_id" && a.Value.String() == "v1.8.2-canary/pod-7f9c" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("expected server_id in LogValue")
+	}
+
+	b, _ := json.Marshal(Internal("boom"))
+	if bytes.Contains(b, []byte("server_id")) {
+		t.Errorf("expected server_id kept out of the body by default, got %s", b)
+	}
+	ExposeServerID = true
+	b, _ = json.Marshal(Internal("boom"))
+	if !bytes.Contains(b, []byte(`"server_id":"v1.8.2-canary/pod-7f9c"`)) {
+		t.Errorf("expected server_id in the body, got %s", b)
+	}
+	if p := ToProblem(Internal("boom")); p.ServerID != ServerID {
+		t.Errorf("expected server_id in problem documents, got %q", p.ServerID)
+	}
+}
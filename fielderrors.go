@@ -0,0 +1,159 @@
+package errenvelope
+
+import "strings"
+
+// FieldMessageSeparator joins multiple messages for the same field in the
+// flat "fields" shape, e.g. "required; invalid format". The messages
+// themselves are also listed under "messages" (see ValidationMessages).
+const FieldMessageSeparator = "; "
+
+// ValidationBuilder accumulates field errors, keeping every message when
+// several rules (or several merged sources) target the same field.
+// The zero value is ready to use.
+//
+// Example:
+//
+//	var v errenvelope.ValidationBuilder
+//	if req.Email == "" {
+//	    v.Add("email", "required")
+//	}
+//	if !strings.Contains(req.Email, "@") {
+//	    v.Add("email", "invalid format")
+//	}
+//	if err := v.Err(); err != nil {
+//	    // fields: {"email": "required; invalid format"}
+//	    // messages: {"email": ["required", "invalid format"]}
+//	    errenvelope.Write(w, r, err)
+//	    return
+//	}
+type ValidationBuilder struct {
+	msgs map[string][]string
+}
+
+// Add records msg for field. Repeated identical messages for the same
+// field are kept once.
+func (b *ValidationBuilder) Add(field, msg string) *ValidationBuilder {
+	if b.msgs == nil {
+		b.msgs = map[string][]string{}
+	}
+	for _, m := range b.msgs[field] {
+		if m == msg {
+			return b
+		}
+	}
+	b.msgs[field] = append(b.msgs[field], msg)
+	return b
+}
+
+// Merge adds every entry of fields, each value as one message. To merge
+// another validation error without losing its separate messages, use
+// MergeError.
+func (b *ValidationBuilder) Merge(fields FieldErrors) *ValidationBuilder {
+	for field, msg := range fields {
+		b.Add(field, msg)
+	}
+	return b
+}
+
+// MergeError adds the messages of a validation error (see
+// ValidationMessages). Errors without field errors add nothing.
+func (b *ValidationBuilder) MergeError(e *Error) *ValidationBuilder {
+	msgs, _ := ValidationMessages(e)
+	for field, list := range msgs {
+		for _, m := range list {
+			b.Add(field, m)
+		}
+	}
+	return b
+}
+
+// Messages returns the messages recorded for field, in the order added.
+func (b *ValidationBuilder) Messages(field string) []string {
+	return append([]string(nil), b.msgs[field]...)
+}
+
+// Len reports the number of fields with errors.
+func (b *ValidationBuilder) Len() int {
+	return len(b.msgs)
+}
+
+// Fields returns the accumulated errors in the flat FieldErrors shape,
+// joining multiple messages for a field with FieldMessageSeparator.
+func (b *ValidationBuilder) Fields() FieldErrors {
+	fields := make(FieldErrors, len(b.msgs))
+	for field, msgs := range b.msgs {
+		fields[field] = strings.Join(msgs, FieldMessageSeparator)
+	}
+	return fields
+}
+
+// Err returns a validation error (400) for the accumulated fields, or nil
+// if none were added. Its details carry both the joined Fields and the
+// separate Messages.
+func (b *ValidationBuilder) Err() *Error {
+	if len(b.msgs) == 0 {
+		return nil
+	}
+	msgs := make(map[string][]string, len(b.msgs))
+	for field, list := range b.msgs {
+		msgs[field] = append([]string(nil), list...)
+	}
+	return Validation(b.Fields()).WithDetails(ValidationDetails{Fields: b.Fields(), Messages: msgs})
+}
+
+// ValidationMessages returns every message per field of a validation
+// error: the Messages of its ValidationDetails (or of the decoded
+// "messages" object), or else each Fields entry as a single message.
+// Returns false if e has no field errors.
+func ValidationMessages(e *Error) (map[string][]string, bool) {
+	if e == nil {
+		return nil, false
+	}
+	var msgs map[string][]string
+	switch d := e.Details.(type) {
+	case ValidationDetails:
+		msgs = d.Messages
+	case *ValidationDetails:
+		if d != nil {
+			msgs = d.Messages
+		}
+	case map[string]any:
+		if raw, ok := d["messages"].(map[string]any); ok {
+			msgs = make(map[string][]string, len(raw))
+			for field, v := range raw {
+				list, _ := v.([]any)
+				for _, m := range list {
+					if s, ok := m.(string); ok {
+						msgs[field] = append(msgs[field], s)
+					}
+				}
+			}
+		}
+	}
+	if len(msgs) > 0 {
+		return msgs, true
+	}
+	fields, ok := ValidationFields(e)
+	if !ok {
+		return nil, false
+	}
+	msgs = make(map[string][]string, len(fields))
+	for field, msg := range fields {
+		msgs[field] = []string{msg}
+	}
+	return msgs, true
+}
+
+// ValidationMulti creates a validation error (400) from several sets of
+// field errors, e.g. from different validators. Unlike merging maps by
+// hand, a field present in more than one set keeps all of its messages.
+func ValidationMulti(sets ...FieldErrors) *Error {
+	var b ValidationBuilder
+	for _, fields := range sets {
+		b.Merge(fields)
+	}
+	if b.Len() == 0 {
+		return Validation(FieldErrors{})
+	}
+	return b.Err()
+}
@@ -0,0 +1,107 @@
+package errenvelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestValidationBuilderDuplicates(t *testing.T) {
+	var b ValidationBuilder
+	b.Add("email", "required").Add("email", "invalid").Add("name", "required")
+
+	if got := b.Messages("email"); !reflect.DeepEqual(got, []string{"required", "invalid"}) {
+		t.Errorf("expected both email messages, got %v", got)
+	}
+
+	e := b.Err()
+	if e.Code != CodeValidationFailed {
+		t.Errorf("expected VALIDATION_FAILED, got %s", e.Code)
+	}
+	fields, _ := ValidationFields(e)
+	if fields["email"] != "required; invalid" {
+		t.Errorf("expected joined messages, got %q", fields["email"])
+	}
+	if fields["name"] != "required" {
+		t.Errorf("expected single message untouched, got %q", fields["name"])
+	}
+}
+
+func TestValidationBuilderMerge(t *testing.T) {
+	var b ValidationBuilder
+	b.Add("email", "required")
+	b.Merge(FieldErrors{"email": "invalid", "age": "must be positive"})
+	b.Merge(FieldErrors{"email": "invalid"}) // already present
+	b.Merge(FieldErrors{"name": "use letters; digits are not allowed"})
+
+	if got := b.Messages("email"); !reflect.DeepEqual(got, []string{"required", "invalid"}) {
+		t.Errorf("expected deduplicated messages, got %v", got)
+	}
+	if got := b.Messages("name"); !reflect.DeepEqual(got, []string{"use letters; digits are not allowed"}) {
+		t.Errorf("expected a message containing the separator kept whole, got %v", got)
+	}
+	if b.Len() != 3 {
+		t.Errorf("expected 3 fields, got %d", b.Len())
+	}
+}
+
+func TestValidationMessages(t *testing.T) {
+	var b ValidationBuilder
+	b.Add("email", "required").Add("email", "must contain; at least one @")
+	e := b.Err()
+
+	want := map[string][]string{"email": {"required", "must contain; at least one @"}}
+	if got, ok := ValidationMessages(e); !ok || !reflect.DeepEqual(got, want) {
+		t.Errorf("expected separate messages, got %v", got)
+	}
+
+	if params := ToProblem(e).InvalidParams; len(params) != 2 || params[1].Reason != "must contain; at least one @" {
+		t.Errorf("expected one invalid-params entry per message, got %v", params)
+	}
+
+	// The list survives a JSON round trip and a merge
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadFrom(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := ValidationMessages(decoded); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected messages decoded from JSON, got %v", got)
+	}
+	var merged ValidationBuilder
+	merged.MergeError(decoded)
+	if got := merged.Messages("email"); !reflect.DeepEqual(got, want["email"]) {
+		t.Errorf("expected merge to keep the messages apart, got %v", got)
+	}
+
+	// Plain validation errors report one message per field
+	if got, _ := ValidationMessages(Validation(FieldErrors{"age": "too low"})); !reflect.DeepEqual(got, map[string][]string{"age": {"too low"}}) {
+		t.Errorf("expected fields as single messages, got %v", got)
+	}
+	if _, ok := ValidationMessages(NotFound("")); ok {
+		t.Error("expected no messages for a non-validation error")
+	}
+}
+
+func TestValidationBuilderEmpty(t *testing.T) {
+	var b ValidationBuilder
+	if b.Err() != nil {
+		t.Error("expected nil error when nothing was added")
+	}
+}
+
+func TestValidationMulti(t *testing.T) {
+	e := ValidationMulti(
+		FieldErrors{"email": "required"},
+		FieldErrors{"email": "invalid", "password": "too short"},
+	)
+	fields, _ := ValidationFields(e)
+	want := FieldErrors{"email": "required; invalid", "password": "too short"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected %v, got %v", want, fields)
+	}
+}
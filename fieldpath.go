@@ -0,0 +1,226 @@
+package errenvelope
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FieldPath builds a FieldErrors key for a nested field. String segments
+// are joined with dots and int segments become indices:
+//
+//	FieldPath("items", 2, "price")  // "items[2].price"
+//	FieldPath("address", "zip")     // "address.zip"
+//
+// Keys stay flat in JSON ({"fields": {"items[2].price": "required"}}),
+// and clients can split them on the same rules. Segments must not
+// themselves contain '.' or '['.
+func FieldPath(segments ...any) string {
+	var b strings.Builder
+	for _, seg := range segments {
+		switch s := seg.(type) {
+		case int:
+			b.WriteByte('[')
+			b.WriteString(strconv.Itoa(s))
+			b.WriteByte(']')
+		default:
+			if b.Len() > 0 {
+				b.WriteByte('.')
+			}
+			fmt.Fprint(&b, s)
+		}
+	}
+	return b.String()
+}
+
+// NestedValidation creates a validation error (400) from a tree of
+// messages mirroring the request body. Leaves are strings; objects are
+// map[string]any and arrays are []any, where nil entries have no errors:
+//
+//	errenvelope.NestedValidation(map[string]any{
+//	    "address": map[string]any{"zip": "required"},
+//	    "items":   []any{nil, nil, map[string]any{"price": "must be positive"}},
+//	})
+//	// fields: {"address.zip": "required", "items[2].price": "must be positive"}
+func NestedValidation(tree map[string]any) *Error {
+	fields := FieldErrors{}
+	flattenFields(fields, "", tree)
+	return Validation(fields)
+}
+
+func flattenFields(fields FieldErrors, prefix string, v any) {
+	switch n := v.(type) {
+	case string:
+		fields[prefix] = n
+	case map[string]any:
+		for k, child := range n {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+			flattenFields(fields, path, child)
+		}
+	case []any:
+		for i, child := range n {
+			flattenFields(fields, prefix+"["+strconv.Itoa(i)+"]", child)
+		}
+	}
+}
+
+// Tree reconstructs the nested shape from dotted/indexed keys, the
+// inverse of NestedValidation: objects become map[string]any, arrays
+// []any (nil where an element has no errors), and leaves the messages.
+// If a key is both a leaf and a parent ("a" and "a.b"), the nested
+// entries win. Indices above 10000 are kept as object keys ("[20000]")
+// rather than expanded into arrays; an array that also gets such a key
+// becomes an object keyed the same way.
+func (f FieldErrors) Tree() map[string]any {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	root := map[string]any{}
+	for _, k := range keys {
+		segs := splitFieldPath(k)
+		if len(segs) == 0 {
+			continue
+		}
+		if n, ok := segs[0].(int); ok {
+			segs[0] = "[" + strconv.Itoa(n) + "]" // the root is always an object
+		}
+		root = setPath(root, segs, f[k]).(map[string]any)
+	}
+	return root
+}
+
+// maxFieldIndex bounds the array indices Tree expands into slices. Keys
+// can come from decoded, untrusted bodies, and "items[50000000]" must not
+// allocate a slice that long; larger indices are kept as object keys.
+const maxFieldIndex = 10000
+
+// splitFieldPath parses "items[2].price" into ["items", 2, "price"].
+// Indices above maxFieldIndex stay names, e.g. "[50000000]".
+func splitFieldPath(path string) []any {
+	var segs []any
+	for _, part := range strings.Split(path, ".") {
+		name, rest, _ := strings.Cut(part, "[")
+		if name != "" {
+			segs = append(segs, name)
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			n, err := strconv.Atoi(idx)
+			if !ok || err != nil || n < 0 || n > maxFieldIndex {
+				// Not an index after all; keep the raw text as a name
+				segs = append(segs, "["+rest)
+				break
+			}
+			segs = append(segs, n)
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return segs
+}
+
+// setPath stores msg at segs inside node, creating containers as needed,
+// and returns the (possibly replaced) node.
+func setPath(node any, segs []any, msg string) any {
+	if len(segs) == 0 {
+		if node != nil {
+			return node // nested entries win over a leaf
+		}
+		return msg
+	}
+	switch seg := segs[0].(type) {
+	case int:
+		if obj, ok := node.(map[string]any); ok {
+			key := "[" + strconv.Itoa(seg) + "]"
+			obj[key] = setPath(obj[key], segs[1:], msg)
+			return obj
+		}
+		arr, _ := node.([]any)
+		for len(arr) <= seg {
+			arr = append(arr, nil)
+		}
+		arr[seg] = setPath(arr[seg], segs[1:], msg)
+		return arr
+	default:
+		obj, ok := node.(map[string]any)
+		if !ok {
+			obj = map[string]any{}
+			if arr, isArr := node.([]any); isArr {
+				for i, v := range arr {
+					if v != nil {
+						obj["["+strconv.Itoa(i)+"]"] = v
+					}
+				}
+			}
+		}
+		key := seg.(string)
+		obj[key] = setPath(obj[key], segs[1:], msg)
+		return obj
+	}
+}
+
+// ValidationFields returns the field errors of a validation error, from
+// the ValidationDetails set by Validation or from the map produced by
+// decoding an envelope from JSON. Returns false if e has no field errors.
+func ValidationFields(e *Error) (FieldErrors, bool) {
+	if e == nil {
+		return nil, false
+	}
+	switch d := e.Details.(type) {
+	case ValidationDetails:
+		return d.Fields, d.Fields != nil
+	case *ValidationDetails:
+		if d == nil || d.Fields == nil {
+			return nil, false
+		}
+		return d.Fields, true
+	case map[string]any:
+		raw, ok := d["fields"].(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		fields := make(FieldErrors, len(raw))
+		for k, v := range raw {
+			if s, ok := v.(string); ok {
+				fields[k] = s
+			}
+		}
+		return fields, true
+	}
+	return nil, false
+}
+
+// ValidationString renders the field errors of a validation error on one
+// line for logs and CLIs, sorted by field name:
+//
+//	age: must be positive; email: invalid format
+//
+// Returns "" if e has no field errors.
+func ValidationString(e *Error) string {
+	fields, ok := ValidationFields(e)
+	if !ok || len(fields) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for i, name := range names {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(fields[name])
+	}
+	return b.String()
+}
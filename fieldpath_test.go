@@ -0,0 +1,158 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFieldPath(t *testing.T) {
+	tests := []struct {
+		segs []any
+		want string
+	}{
+		{[]any{"email"}, "email"},
+		{[]any{"address", "zip"}, "address.zip"},
+		{[]any{"items", 2, "price"}, "items[2].price"},
+		{[]any{"matrix", 0, 1}, "matrix[0][1]"},
+	}
+	for _, tt := range tests {
+		if got := FieldPath(tt.segs...); got != tt.want {
+			t.Errorf("FieldPath(%v) = %q, want %q", tt.segs, got, tt.want)
+		}
+	}
+}
+
+func TestNestedValidation(t *testing.T) {
+	e := NestedValidation(map[string]any{
+		"address": map[string]any{"zip": "required"},
+		"items":   []any{nil, nil, map[string]any{"price": "must be positive"}},
+	})
+
+	if e.Code != CodeValidationFailed {
+		t.Errorf("expected VALIDATION_FAILED, got %s", e.Code)
+	}
+	fields, ok := ValidationFields(e)
+	if !ok {
+		t.Fatal("expected field errors")
+	}
+	want := FieldErrors{"address.zip": "required", "items[2].price": "must be positive"}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("expected %v, got %v", want, fields)
+	}
+}
+
+func TestNestedFieldsRoundTrip(t *testing.T) {
+	e := Validation(FieldErrors{
+		"address.zip":          "required",
+		"items[2].price":       "must be positive",
+		"items[0].tags[1]":     "too long",
+		"customer.name.family": "required",
+	})
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	var decoded Error
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+
+	fields, ok := ValidationFields(&decoded)
+	if !ok {
+		t.Fatal("expected field errors after round-trip")
+	}
+	if fields["items[2].price"] != "must be positive" || fields["address.zip"] != "required" {
+		t.Errorf("expected flat keys to survive, got %v", fields)
+	}
+
+	tree := fields.Tree()
+	want := map[string]any{
+		"address":  map[string]any{"zip": "required"},
+		"customer": map[string]any{"name": map[string]any{"family": "required"}},
+		"items": []any{
+			map[string]any{"tags": []any{nil, "too long"}},
+			nil,
+			map[string]any{"price": "must be positive"},
+		},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Errorf("unexpected tree:\n got %#v\nwant %#v", tree, want)
+	}
+}
+
+func TestFieldErrorsTreeConflict(t *testing.T) {
+	tree := FieldErrors{"address": "invalid", "address.zip": "required", "[0]": "odd"}.Tree()
+	if _, ok := tree["address"].(map[string]any); !ok {
+		t.Errorf("expected nested entries to win, got %#v", tree["address"])
+	}
+	if tree["[0]"] != "odd" {
+		t.Errorf("expected root index kept as a key, got %#v", tree)
+	}
+}
+
+func TestFieldErrorsTreeHugeIndex(t *testing.T) {
+	tree := FieldErrors{
+		"items[50000000].price": "bad",
+		"items[3].name":         "required",
+	}.Tree()
+	items, ok := tree["items"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected huge index to keep items an object, got %T", tree["items"])
+	}
+	huge, ok := items["[50000000]"].(map[string]any)
+	if !ok || huge["price"] != "bad" {
+		t.Errorf("expected huge index kept as a key, got %#v", items)
+	}
+	if small, ok := items["[3]"].(map[string]any); !ok || small["name"] != "required" {
+		t.Errorf("expected small index kept alongside, got %#v", items)
+	}
+
+	sparse := FieldErrors{"items[3].name": "required"}.Tree()
+	arr, ok := sparse["items"].([]any)
+	if !ok || len(arr) != 4 || arr[0] != nil {
+		t.Fatalf("expected sparse array padded to 4, got %#v", sparse["items"])
+	}
+}
+
+func TestValidationFieldsMissing(t *testing.T) {
+	if _, ok := ValidationFields(nil); ok {
+		t.Error("expected false for nil error")
+	}
+	if _, ok := ValidationFields(NotFound("x")); ok {
+		t.Error("expected false for non-validation error")
+	}
+}
+
+func TestValidationString(t *testing.T) {
+	e := Validation(FieldErrors{
+		"email":                      "invalid format",
+		"age":                        "must be positive",
+		"address.zip":                "required",
+		FieldPath("items", 0, "sku"): "unknown",
+	})
+	want := "address.zip: required; age: must be positive; email: invalid format; items[0].sku: unknown"
+	for i := 0; i < 20; i++ {
+		if got := ValidationString(e); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+
+	// Also after a JSON round trip
+	data, _ := json.Marshal(e)
+	var decoded Error
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if got := ValidationString(&decoded); got != want {
+		t.Errorf("expected %q after decoding, got %q", want, got)
+	}
+
+	if got := ValidationString(NotFound("")); got != "" {
+		t.Errorf("expected empty string without field errors, got %q", got)
+	}
+	if got := ValidationString(nil); got != "" {
+		t.Errorf("expected empty string for nil, got %q", got)
+	}
+}
@@ -3,9 +3,12 @@ module github.com/blackwell-systems/err-envelope
 go 1.23.0
 
 require (
+	github.com/aws/aws-lambda-go v1.47.0
 	github.com/gin-gonic/gin v1.10.0
 	github.com/go-chi/chi/v5 v5.2.0
+	github.com/grpc-ecosystem/grpc-gateway/v2 v2.22.0
 	github.com/labstack/echo/v4 v4.13.3
+	google.golang.org/grpc v1.67.1
 )
 
 require (
@@ -37,6 +40,8 @@ require (
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
 	golang.org/x/text v0.21.0 // indirect
-	google.golang.org/protobuf v1.34.1 // indirect
+	google.golang.org/genproto/googleapis/api v0.0.0-20240814211410-ddb44dafa142 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240814211410-ddb44dafa142 // indirect
+	google.golang.org/protobuf v1.34.2 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
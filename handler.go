@@ -0,0 +1,44 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// WrapHandler adapts a "result or error" function into an http.Handler,
+// removing the usual branching from handlers. On error, the error is
+// mapped with From and written with Write. On success, the result is
+// written by enc, or encoded as JSON with status 200 if enc is nil. The
+// request's trace ID is set as a response header in both cases.
+//
+//	mux.Handle("GET /users/{id}", errenvelope.WrapHandler(func(r *http.Request) (any, error) {
+//	    return store.User(r.Context(), r.PathValue("id"))
+//	}, nil))
+func WrapHandler(h func(*http.Request) (any, error), enc func(http.ResponseWriter, any)) http.Handler {
+	return defaultEnvelope().WrapHandler(h, enc)
+}
+
+// WrapHandler is like the package-level WrapHandler, using env's configuration.
+func (env *Envelope) WrapHandler(h func(*http.Request) (any, error), enc func(http.ResponseWriter, any)) http.Handler {
+	if enc == nil {
+		enc = encodeJSON
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := h(r)
+		if err != nil {
+			env.Write(w, r, err)
+			return
+		}
+		if id := env.TraceIDFromRequest(r); id != "" {
+			w.Header().Set(env.traceHeader(), id)
+		}
+		enc(w, v)
+	})
+}
+
+// encodeJSON is WrapHandler's default success encoder.
+func encodeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(v)
+}
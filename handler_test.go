@@ -0,0 +1,71 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrapHandler(t *testing.T) {
+	type user struct {
+		ID string `json:"id"`
+	}
+	h := WrapHandler(func(r *http.Request) (any, error) {
+		if r.URL.Path == "/missing" {
+			return nil, NotFound("User not found")
+		}
+		if r.URL.Path == "/broken" {
+			return nil, errors.New("db down")
+		}
+		return user{ID: "42"}, nil
+	}, nil)
+
+	// Success: JSON-encoded result with the trace header
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/users/42", nil)
+	r.Header.Set(HeaderTraceID, "trace-ok")
+	h.ServeHTTP(w, r)
+	var got user
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || got.ID != "42" {
+		t.Errorf("expected encoded result, got %q (%v)", w.Body.String(), err)
+	}
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != ContentTypeJSON {
+		t.Errorf("unexpected success response: %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get(HeaderTraceID) != "trace-ok" {
+		t.Errorf("expected trace header on success, got %q", w.Header().Get(HeaderTraceID))
+	}
+
+	// Error: written as an envelope
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/missing", nil)
+	r.Header.Set(HeaderTraceID, "trace-err")
+	h.ServeHTTP(w, r)
+	e, err := ReadFrom(w.Body)
+	if err != nil || e.Code != CodeNotFound || e.TraceID != "trace-err" || w.Code != http.StatusNotFound {
+		t.Errorf("expected NOT_FOUND envelope, got %d %+v (%v)", w.Code, e, err)
+	}
+
+	// Plain errors are mapped with From
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/broken", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", w.Code)
+	}
+}
+
+func TestWrapHandlerCustomEncoder(t *testing.T) {
+	h := WrapHandler(func(r *http.Request) (any, error) {
+		return "created", nil
+	}, func(w http.ResponseWriter, v any) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(v.(string)))
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/", nil))
+	if w.Code != http.StatusCreated || w.Body.String() != "created" {
+		t.Errorf("expected custom encoding, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -1,49 +1,413 @@
 package errenvelope
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 )
 
 const (
 	// HeaderTraceID is the standard header name for trace/request IDs.
 	HeaderTraceID = "X-Request-Id"
+
+	// ContentTypeJSON is the media type of the default error envelope.
+	ContentTypeJSON = "application/json"
+
+	// ContentTypeProblem is the RFC 7807 problem details media type.
+	ContentTypeProblem = "application/problem+json"
+)
+
+// AlwaysArray makes Write serialize every envelope inside an "errors" array,
+// e.g. {"errors": [{"code": "NOT_FOUND", ...}]}, so clients can handle
+// single and multiple errors with one code path. Off by default.
+// Set once at startup; it is not safe to change while serving requests.
+var AlwaysArray bool
+
+// StrictAccept makes Write respond 406 NOT_ACCEPTABLE when the request's
+// Accept header rules out every media type Write can produce (for example
+// "text/csv" or "text/csv, */*;q=0"). Off by default, in which case such
+// requests still receive JSON. Set once at startup.
+var StrictAccept bool
+
+// NegotiateProblem makes Write answer clients that prefer
+// application/problem+json with an RFC 7807 document (see WriteProblem)
+// instead of the JSON envelope. Off by default, so Write always sends the
+// envelope whatever the Accept header says. Set once at startup.
+var NegotiateProblem bool
+
+// OnWriteError, if set, is called when an error response can't be
+// delivered. clientGone reports whether the failure is a client disconnect
+// (see IsClientDisconnect), which is routine and usually only worth a
+// debug log or a low-severity counter. Otherwise the failure is a bug,
+// such as details that can't be marshaled; the response is still sent
+// with the details dropped, but the hook should alert. r is nil for
+// writers without a request (WriteSSEError). Set once at startup.
+var OnWriteError func(r *http.Request, err error, clientGone bool)
+
+// IsClientDisconnect reports whether err from writing a response means
+// the client went away: a closed connection, broken pipe, connection
+// reset, or canceled request context.
+func IsClientDisconnect(err error) bool {
+	return errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.ErrClosedPipe) ||
+		errors.Is(err, context.Canceled)
+}
+
+func (env *Envelope) reportWriteError(r *http.Request, err error, clientGone bool) {
+	if env.OnWriteError != nil {
+		env.OnWriteError(r, err, clientGone)
+	}
+}
+
+// bodyShape selects the value marshalBody encodes for an error.
+type bodyShape int
+
+const (
+	shapeEnvelope bodyShape = iota // Write's envelope, honoring AlwaysArray
+	shapeProblem                   // RFC 7807 problem document
+	shapeBare                      // the error itself, as in SSE events
+)
+
+// bodyValue builds the value to encode for e in the given shape.
+func (env *Envelope) bodyValue(r *http.Request, e *Error, shape bodyShape) any {
+	switch shape {
+	case shapeEnvelope:
+		return env.envelopeValue(env.bodyError(e))
+	case shapeProblem:
+		p := ToProblem(env.bodyError(e))
+		p.Instance = env.instance(r)
+		if u := env.docsURL(e.Code); u != "" {
+			p.Type = u
+		}
+		return p
+	}
+	return e
+}
+
+// marshalBody encodes e in the given shape into a pooled buffer, with the
+// trailing newline json.Encoder writes. If that fails (typically
+// unmarshalable details), the failure is reported and e's details are
+// dropped so the client still receives a well-formed envelope. The caller
+// must release the buffer once it is written.
+func (env *Envelope) marshalBody(r *http.Request, e *Error, shape bodyShape) *bodyBuffer {
+	b := getBodyBuffer()
+	if err := b.enc.Encode(env.bodyValue(r, e, shape)); err != nil {
+		env.reportWriteError(r, fmt.Errorf("errenvelope: marshal %s envelope: %w", e.Code, err), false)
+		e.Details = nil
+		b.Reset()
+		_ = b.enc.Encode(env.bodyValue(r, e, shape))
+	}
+	return b
+}
+
+// OmitTraceIDInBody leaves trace_id out of response bodies written by
+// Write, WriteProblem, and WriteMultiStatus; the trace header still
+// carries it. Use it between internal services, where the body copy is
+// redundant, and keep it off at the edge so clients can quote the ID to
+// support. Off by default. Set once at startup.
+var OmitTraceIDInBody bool
+
+// bodyError returns e as serialized in a response body, without its
+// trace ID when OmitTraceIDInBody is set.
+func (env *Envelope) bodyError(e *Error) *Error {
+	if !env.OmitTraceIDInBody || e.TraceID == "" {
+		return e
+	}
+	c := *e
+	c.TraceID = ""
+	return &c
+}
+
+// RetryableForMethod makes Write clear Retryable on errors for requests
+// with a non-idempotent method (POST, PATCH, CONNECT, or any extension
+// method): a server error there may have happened after side effects, so
+// a blind retry isn't safe. Idempotent methods (GET, HEAD, OPTIONS,
+// TRACE, PUT, DELETE) keep Retryable as set. Codes
+// allowed with SetRetryableOnAnyMethod are exempt. Set once at startup.
+var RetryableForMethod bool
+
+// retryableOnAnyMethod holds codes that keep Retryable regardless of method.
+var (
+	anyMethodMu          sync.RWMutex
+	retryableOnAnyMethod = map[Code]bool{
+		CodeRateLimited: true,
+	}
+)
+
+func isRetryableOnAnyMethod(code Code) bool {
+	anyMethodMu.RLock()
+	defer anyMethodMu.RUnlock()
+	return retryableOnAnyMethod[code]
+}
+
+// SetRetryableOnAnyMethod exempts code from the RetryableForMethod
+// downgrade, for errors that reject a request before any side effect.
+// CodeRateLimited is exempt by default; pass false to remove a code.
+// Call at startup, before serving requests; it is safe to call
+// concurrently with Write.
+func SetRetryableOnAnyMethod(code Code, ok bool) {
+	anyMethodMu.Lock()
+	defer anyMethodMu.Unlock()
+	if !ok {
+		delete(retryableOnAnyMethod, code)
+		return
+	}
+	retryableOnAnyMethod[code] = true
+}
+
+// isIdempotentMethod reports whether repeating a request with method has
+// the same effect as sending it once, per RFC 7231 section 4.2.2: the
+// safe methods plus PUT and DELETE. POST, PATCH (RFC 5789), CONNECT, and
+// unknown extension methods are not. An empty method means GET, as in
+// net/http.
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// DocsBaseURL, when set, gives every error without its own HelpURL a
+// documentation link: the base URL plus the code as a lowercase,
+// hyphenated slug, e.g. "https://docs.example.com/errors" yields
+// "https://docs.example.com/errors/not-found" for NOT_FOUND. Write sends
+// it as help_url and as a Link header with rel="help"; WriteProblem also
+// uses it as the problem type. Empty (the default) adds no link. Set once
+// at startup.
+var DocsBaseURL string
+
+// DocsSlug, if set, maps a code to the page under DocsBaseURL, replacing
+// the default lowercase, hyphenated slug:
+//
+//	errenvelope.DocsSlug = func(c errenvelope.Code) string {
+//	    return strings.ToLower(string(c)) + ".html"
+//	}
+//
+// Set once at startup.
+var DocsSlug func(code Code) string
+
+// codeSlug returns the default documentation slug for a code.
+func codeSlug(c Code) string {
+	return strings.ToLower(strings.ReplaceAll(string(c), "_", "-"))
+}
+
+// writeBody writes an encoded body, reporting write failures, then
+// flushes it so clients on long-lived connections or behind buffering
+// proxies get the error without waiting for the handler to return.
+// Writers that can't flush are left as they are. HEAD responses carry
+// only the status and headers; a body would violate the protocol.
+func (env *Envelope) writeBody(w http.ResponseWriter, r *http.Request, body []byte) {
+	if r != nil && r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(body); err != nil {
+		env.reportWriteError(r, err, IsClientDisconnect(err))
+		return
+	}
+	if err := flush(w); err != nil {
+		env.reportWriteError(r, err, IsClientDisconnect(err))
+	}
+}
+
+// flush flushes w if it can. A direct http.Flusher is flushed without
+// allocating; wrapped writers go through http.ResponseController, which
+// finds a flusher behind Unwrap. Writers that can't flush return nil.
+func flush(w http.ResponseWriter) error {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+		return nil
+	}
+	if _, ok := w.(interface{ Unwrap() http.ResponseWriter }); !ok {
+		return nil
+	}
+	if err := http.NewResponseController(w).Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	return nil
+}
+
+// ContentType is the media type Write uses for the JSON envelope, e.g. a
+// vendor type like "application/vnd.acme.error+json". The body structure
+// is unchanged. Clients asking for application/json still get the
+// envelope under this type, and problem+json responses keep their own
+// type. Defaults to application/json. Set once at startup.
+var ContentType = ContentTypeJSON
+
+// defaultOffers are the media types Write produces with the default ContentType.
+var (
+	defaultOffers     = []string{ContentTypeJSON}
+	defaultOffersWith = []string{ContentTypeJSON, ContentTypeProblem}
 )
 
+// offeredTypes returns the media types Write can produce, in preference
+// order. problem+json is offered only with NegotiateProblem.
+func (env *Envelope) offeredTypes() []string {
+	ct := env.contentType()
+	switch {
+	case ct == ContentTypeJSON && env.NegotiateProblem:
+		return defaultOffersWith
+	case ct == ContentTypeJSON:
+		return defaultOffers
+	case env.NegotiateProblem:
+		return []string{ct, ContentTypeProblem, ContentTypeJSON}
+	}
+	return []string{ct, ContentTypeJSON}
+}
+
 // Write writes a consistent JSON error envelope to the response.
 // If TraceID is missing on the error, it tries to derive it from the request.
-func Write(w http.ResponseWriter, r *http.Request, err error) {
-	e := From(err)
+//
+// With NegotiateProblem set, the representation is negotiated from the
+// request's Accept header: clients that prefer application/problem+json
+// receive an RFC 7807 document (see WriteProblem). Everyone else gets
+// the JSON envelope (or a 406 if StrictAccept is set and nothing is
+// acceptable).
+//
+// A nil err writes 204 No Content; use WriteError to leave the response
+// untouched instead. Options (e.g. ForceNonRetryable) adjust the written
+// copy, never err itself.
+func Write(w http.ResponseWriter, r *http.Request, err error, opts ...WriteOption) {
+	defaultEnvelope().Write(w, r, err, opts...)
+}
+
+// WriteOption adjusts the copy of an error that Write sends, for policy
+// that belongs to the endpoint rather than the error.
+type WriteOption func(*Error)
+
+// ForceNonRetryable makes Write report retryable:false and drop any retry
+// delay and Retry-After header, whatever the error's code, for endpoints
+// where a retry is dangerous (e.g. redeeming a one-time token). A
+// retry_policy detail is removed as well.
+//
+//	errenvelope.Write(w, r, err, errenvelope.ForceNonRetryable())
+func ForceNonRetryable() WriteOption {
+	return func(e *Error) {
+		e.Retryable = false
+		e.RetryAfter = 0
+		e.RetryAt = time.Time{}
+		if e.Headers.Get("Retry-After") != "" {
+			e.Headers = e.Headers.Clone()
+			e.Headers.Del("Retry-After")
+		}
+		e.Details = withoutDetail(e.Details, "retry_policy")
+	}
+}
+
+// WriteError is like Write, except that a nil err is a no-op: nothing is
+// written and no headers are committed, so the handler can still write
+// its own response.
+//
+//	errenvelope.WriteError(w, r, err)
+//	if err == nil {
+//	    json.NewEncoder(w).Encode(result)
+//	}
+func WriteError(w http.ResponseWriter, r *http.Request, err error, opts ...WriteOption) {
+	defaultEnvelope().WriteError(w, r, err, opts...)
+}
+
+// WriteError is like the package-level WriteError, using env's configuration.
+func (env *Envelope) WriteError(w http.ResponseWriter, r *http.Request, err error, opts ...WriteOption) {
+	if err == nil {
+		return
+	}
+	env.Write(w, r, err, opts...)
+}
+
+// Write is like the package-level Write, using env's configuration.
+func (env *Envelope) Write(w http.ResponseWriter, r *http.Request, err error, opts ...WriteOption) {
+	e := env.From(err)
 	if e == nil {
 		w.WriteHeader(http.StatusNoContent)
 		return
 	}
 
-	if e.TraceID == "" {
-		e.TraceID = TraceIDFromRequest(r)
+	offered := env.offeredTypes()
+	ct := negotiate(acceptHeader(r), offered...)
+	if ct == "" {
+		if env.StrictAccept {
+			e = NotAcceptable("").WithDetails(map[string]any{
+				"supported": append([]string(nil), offered...),
+			})
+		}
+		ct = ContentTypeJSON
+	}
+
+	// Work on a pooled copy so shared errors (e.g. sentinels) are never mutated
+	e = env.acquire(e, r)
+	defer Release(e)
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	if ct == ContentTypeProblem {
+		env.writeProblem(w, r, e)
+		return
+	}
+
+	body := env.marshalBody(r, e, shapeEnvelope)
+	defer releaseBodyBuffer(body)
+	status := env.prepare(w, e)
+
+	w.Header().Set("Content-Type", env.contentType())
+	w.WriteHeader(status)
+
+	env.writeBody(w, r, body.Bytes())
+}
+
+// envelopeValue returns the value to serialize for e: e itself, or a
+// one-element errorList when AlwaysArray is set.
+func (env *Envelope) envelopeValue(e *Error) any {
+	if env.AlwaysArray {
+		return errorList{Errors: []*Error{e}}
+	}
+	return e
+}
+
+// errorList is the body shape used when AlwaysArray is enabled.
+type errorList struct {
+	Errors []*Error `json:"errors"`
+}
+
+// prepare sets the shared response headers and returns the status to write.
+func (env *Envelope) prepare(w http.ResponseWriter, e *Error) int {
+	for key, values := range e.Headers {
+		w.Header()[key] = append([]string(nil), values...)
 	}
 
 	if e.TraceID != "" {
-		w.Header().Set(HeaderTraceID, e.TraceID)
+		w.Header().Set(env.traceHeader(), e.TraceID)
 	}
 
-	// Set Retry-After header if specified (rate limiting, unavailable, etc.)
-	if e.RetryAfter > 0 {
-		seconds := int(e.RetryAfter.Seconds())
-		if seconds < 1 {
-			seconds = 1 // Minimum 1 second
-		}
-		w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
+	// Appended, so Link headers the handler set (pagination, preload) stay
+	if e.HelpURL != "" {
+		w.Header().Add("Link", "<"+e.HelpURL+`>; rel="help"`)
 	}
 
-	status := e.Status
-	if status == 0 {
-		status = http.StatusInternalServerError
+	// Set Retry-After header if specified (rate limiting, unavailable, etc.).
+	// The header only carries whole seconds, so round up: a client must
+	// never retry early. The body keeps the precise duration.
+	if d := e.retryDelay(); d > 0 {
+		seconds := int((d + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", fmt.Sprintf("%d", seconds))
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
+	return e.EffectiveStatus()
+}
 
-	_ = json.NewEncoder(w).Encode(e)
+func acceptHeader(r *http.Request) string {
+	if r == nil {
+		return ""
+	}
+	return r.Header.Get("Accept")
 }
@@ -1,11 +1,17 @@
 package errenvelope
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 )
@@ -280,3 +286,679 @@ func TestWriteWithoutRetryAfter(t *testing.T) {
 		t.Errorf("expected no Retry-After header, got %s", retryAfter)
 	}
 }
+
+func TestWriteLengthRequiredAndPayloadTooLarge(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        *Error
+		wantStatus int
+		wantCode   Code
+	}{
+		{"411", LengthRequired("missing Content-Length"), http.StatusLengthRequired, CodeLengthRequired},
+		{"413", PayloadTooLarge("upload exceeds 10MB"), http.StatusRequestEntityTooLarge, CodePayloadTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("POST", "/upload", nil)
+
+			Write(w, r, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, w.Code)
+			}
+			if h := w.Header().Get("Retry-After"); h != "" {
+				t.Errorf("expected no Retry-After header, got %s", h)
+			}
+
+			var response map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if response["code"] != string(tt.wantCode) {
+				t.Errorf("expected code %s, got %v", tt.wantCode, response["code"])
+			}
+			if response["retryable"] != false {
+				t.Errorf("expected retryable false, got %v", response["retryable"])
+			}
+			if _, ok := response["retry_after"]; ok {
+				t.Error("expected retry_after to be omitted")
+			}
+		})
+	}
+}
+
+func TestWriteAlwaysArray(t *testing.T) {
+	t.Run("default single object", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/test", nil)
+
+		Write(w, r, NotFound("user not found"))
+
+		var response map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if response["code"] != "NOT_FOUND" {
+			t.Errorf("expected top-level code NOT_FOUND, got %v", response["code"])
+		}
+		if _, ok := response["errors"]; ok {
+			t.Error("expected no errors array by default")
+		}
+	})
+
+	t.Run("always array", func(t *testing.T) {
+		AlwaysArray = true
+		t.Cleanup(func() { AlwaysArray = false })
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/test", nil)
+		r.Header.Set(HeaderTraceID, "trace-arr")
+
+		Write(w, r, NotFound("user not found"))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+
+		var response struct {
+			Code   string  `json:"code"`
+			Errors []Error `json:"errors"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if response.Code != "" {
+			t.Errorf("expected no top-level code, got %s", response.Code)
+		}
+		if len(response.Errors) != 1 {
+			t.Fatalf("expected 1 error in array, got %d", len(response.Errors))
+		}
+		if response.Errors[0].Code != CodeNotFound || response.Errors[0].TraceID != "trace-arr" {
+			t.Errorf("unexpected array element: %+v", response.Errors[0])
+		}
+	})
+}
+
+func TestDefaultRetryAfter(t *testing.T) {
+	SetDefaultRetryAfter(CodeRateLimited, 5*time.Second)
+	t.Cleanup(func() { SetDefaultRetryAfter(CodeRateLimited, 0) })
+
+	err := RateLimited("slow down")
+	if err.RetryAfter != 5*time.Second {
+		t.Errorf("expected default RetryAfter 5s, got %v", err.RetryAfter)
+	}
+
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/test", nil), err)
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("expected Retry-After 5, got %q", got)
+	}
+
+	// Explicit value overrides the default
+	w = httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/test", nil), RateLimited("slow down").WithRetryAfter(30*time.Second))
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After 30, got %q", got)
+	}
+
+	// Other codes are unaffected
+	if d := Unavailable("down").RetryAfter; d != 0 {
+		t.Errorf("expected no default for UNAVAILABLE, got %v", d)
+	}
+
+	// Removing the default
+	SetDefaultRetryAfter(CodeRateLimited, 0)
+	if d := RateLimited("slow down").RetryAfter; d != 0 {
+		t.Errorf("expected default to be removed, got %v", d)
+	}
+}
+
+func TestWriteRetryAtPrecedence(t *testing.T) {
+	fixed := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+
+	tests := []struct {
+		name       string
+		err        *Error
+		wantHeader string
+		wantBody   any
+	}{
+		{
+			name:       "both set, RetryAt wins",
+			err:        Unavailable("").WithRetryAfter(5 * time.Second).WithRetryAt(fixed.Add(90 * time.Second)),
+			wantHeader: "90",
+			wantBody:   "1m30s",
+		},
+		{
+			name:       "RetryAt rounds up to whole seconds",
+			err:        Unavailable("").WithRetryAt(fixed.Add(1500 * time.Millisecond)),
+			wantHeader: "2",
+			wantBody:   "2s",
+		},
+		{
+			name:       "RetryAt in the past sends no hint",
+			err:        Unavailable("").WithRetryAfter(5 * time.Second).WithRetryAt(fixed.Add(-time.Minute)),
+			wantHeader: "",
+			wantBody:   nil,
+		},
+		{
+			name:       "only RetryAfter",
+			err:        Unavailable("").WithRetryAfter(30 * time.Second),
+			wantHeader: "30",
+			wantBody:   "30s",
+		},
+		{
+			name:       "neither",
+			err:        Unavailable(""),
+			wantHeader: "",
+			wantBody:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			Write(w, httptest.NewRequest("GET", "/", nil), tt.err)
+
+			if got := w.Header().Get("Retry-After"); got != tt.wantHeader {
+				t.Errorf("expected Retry-After %q, got %q", tt.wantHeader, got)
+			}
+			var body map[string]any
+			_ = json.Unmarshal(w.Body.Bytes(), &body)
+			if body["retry_after"] != tt.wantBody {
+				t.Errorf("expected retry_after %v, got %v", tt.wantBody, body["retry_after"])
+			}
+		})
+	}
+}
+
+// brokenWriter simulates a response whose client has gone away.
+type brokenWriter struct {
+	header http.Header
+	err    error
+}
+
+func (b *brokenWriter) Header() http.Header       { return b.header }
+func (b *brokenWriter) WriteHeader(int)           {}
+func (b *brokenWriter) Write([]byte) (int, error) { return 0, b.err }
+
+func TestIsClientDisconnect(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"broken pipe", &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}, true},
+		{"connection reset", &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.ECONNRESET)}, true},
+		{"closed conn", fmt.Errorf("write: %w", net.ErrClosed), true},
+		{"canceled", context.Canceled, true},
+		{"marshal failure", &json.UnsupportedTypeError{}, false},
+		{"other", errors.New("disk full"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsClientDisconnect(tt.err); got != tt.want {
+				t.Errorf("IsClientDisconnect(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnWriteErrorClientGone(t *testing.T) {
+	var gotErr error
+	var gotGone bool
+	OnWriteError = func(r *http.Request, err error, clientGone bool) {
+		gotErr, gotGone = err, clientGone
+	}
+	t.Cleanup(func() { OnWriteError = nil })
+
+	writeErr := &net.OpError{Op: "write", Net: "tcp", Err: os.NewSyscallError("write", syscall.EPIPE)}
+	w := &brokenWriter{header: http.Header{}, err: writeErr}
+	Write(w, httptest.NewRequest("GET", "/", nil), NotFound("gone"))
+
+	if !errors.Is(gotErr, syscall.EPIPE) {
+		t.Errorf("expected broken pipe reported, got %v", gotErr)
+	}
+	if !gotGone {
+		t.Error("expected broken pipe to be classified as client disconnect")
+	}
+}
+
+func TestOnWriteErrorMarshalFailure(t *testing.T) {
+	var gotErr error
+	gotGone := true
+	OnWriteError = func(r *http.Request, err error, clientGone bool) {
+		gotErr, gotGone = err, clientGone
+	}
+	t.Cleanup(func() { OnWriteError = nil })
+
+	original := Internal("boom").WithDetails(map[string]any{"callback": func() {}})
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), original)
+
+	if gotErr == nil || gotGone {
+		t.Fatalf("expected marshal failure reported as not client-gone, got %v (gone=%v)", gotErr, gotGone)
+	}
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", w.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a well-formed fallback envelope, got %q", w.Body.String())
+	}
+	if body["code"] != string(CodeInternal) || body["details"] != nil {
+		t.Errorf("expected envelope without details, got %v", body)
+	}
+	if original.Details == nil {
+		t.Error("caller's error should not be mutated")
+	}
+}
+
+func TestWriteVendorContentType(t *testing.T) {
+	negotiateProblem(t)
+	ContentType = "application/vnd.acme.error+json"
+	t.Cleanup(func() { ContentType = ContentTypeJSON })
+
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/vnd.acme.error+json"},
+		{"application/json", "application/vnd.acme.error+json"},
+		{"application/vnd.acme.error+json", "application/vnd.acme.error+json"},
+		{"application/problem+json", ContentTypeProblem},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+			Write(w, r, NotFound("missing"))
+
+			if ct := w.Header().Get("Content-Type"); ct != tt.want {
+				t.Errorf("expected Content-Type %s, got %s", tt.want, ct)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["code"] != string(CodeNotFound) {
+				t.Errorf("expected JSON envelope body, got %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWriteHeadRequest(t *testing.T) {
+	negotiateProblem(t)
+	err := Unavailable("down for a moment").WithTraceID("trace-head").WithRetryAfter(30 * time.Second)
+
+	for name, accept := range map[string]string{"envelope": "", "problem": ContentTypeProblem} {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodHead, "/status", nil)
+			if accept != "" {
+				r.Header.Set("Accept", accept)
+			}
+
+			Write(w, r, err)
+
+			if w.Code != http.StatusServiceUnavailable {
+				t.Errorf("expected status 503, got %d", w.Code)
+			}
+			if w.Body.Len() != 0 {
+				t.Errorf("expected empty body, got %q", w.Body.String())
+			}
+			if got := w.Header().Get(HeaderTraceID); got != "trace-head" {
+				t.Errorf("expected trace header, got %q", got)
+			}
+			if got := w.Header().Get("Retry-After"); got != "30" {
+				t.Errorf("expected Retry-After 30, got %q", got)
+			}
+		})
+	}
+}
+
+func TestWriteHelpLink(t *testing.T) {
+	negotiateProblem(t)
+	// Explicit help URL
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/x", nil), NotFound("").WithHelpURL("https://docs.example.com/not-found"))
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if got := w.Header().Get("Link"); got != `<https://docs.example.com/not-found>; rel="help"` {
+		t.Errorf("unexpected Link header %q", got)
+	}
+	if body["help_url"] != "https://docs.example.com/not-found" {
+		t.Errorf("expected help_url in body, got %v", body["help_url"])
+	}
+
+	// No URL available: no header, no field
+	w = httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/x", nil), NotFound(""))
+	if got := w.Header().Get("Link"); got != "" {
+		t.Errorf("expected no Link header, got %q", got)
+	}
+	if bytes.Contains(w.Body.Bytes(), []byte("help_url")) {
+		t.Errorf("expected no help_url, got %s", w.Body.String())
+	}
+
+	// Derived from DocsBaseURL, in both body and header
+	DocsBaseURL = "https://docs.example.com/errors/"
+	t.Cleanup(func() { DocsBaseURL = "" })
+	sentinel := ErrRateLimited
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/x", nil)
+	r.Header.Set("Accept", ContentTypeProblem)
+	Write(w, r, sentinel)
+	var problem Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	want := "https://docs.example.com/errors/rate-limited"
+	if problem.HelpURL != want {
+		t.Errorf("expected help_url %q, got %q", want, problem.HelpURL)
+	}
+	if got := w.Header().Get("Link"); got != "<"+want+`>; rel="help"` {
+		t.Errorf("Link header %q doesn't match help_url %q", got, problem.HelpURL)
+	}
+	if sentinel.HelpURL != "" {
+		t.Error("expected the sentinel to be left unchanged")
+	}
+}
+
+func TestWriteHelpLinkKeepsExistingLink(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.Header().Set("Link", `</users?page=2>; rel="next"`)
+	Write(w, httptest.NewRequest("GET", "/users", nil), NotFound("").WithHelpURL("https://docs.example.com/not-found"))
+
+	want := []string{`</users?page=2>; rel="next"`, `<https://docs.example.com/not-found>; rel="help"`}
+	if got := w.Header().Values("Link"); len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("expected the help link appended, got %q", got)
+	}
+}
+
+func TestWriteErrorNilIsNoop(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, httptest.NewRequest("GET", "/", nil), nil)
+	if w.Code != http.StatusOK || w.Body.Len() != 0 || len(w.Header()) != 0 || w.Flushed {
+		t.Errorf("expected the writer untouched, got %d %v %q", w.Code, w.Header(), w.Body.String())
+	}
+
+	// The handler can still respond
+	w.WriteHeader(http.StatusCreated)
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected handler's status, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	WriteError(w, httptest.NewRequest("GET", "/", nil), NotFound(""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected errors to be written like Write, got %d", w.Code)
+	}
+
+	// Write keeps the explicit 204
+	w = httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), nil)
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected 204 from Write, got %d", w.Code)
+	}
+}
+
+func TestRetryableForMethod(t *testing.T) {
+	RetryableForMethod = true
+	t.Cleanup(func() { RetryableForMethod = false })
+
+	write := func(method string, e *Error) *Error {
+		t.Helper()
+		w := httptest.NewRecorder()
+		Write(w, httptest.NewRequest(method, "/orders", nil), e)
+		got, err := ReadFrom(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if write("POST", Unavailable("")).Retryable {
+		t.Error("expected 503 on POST to be downgraded")
+	}
+	if !write("GET", Unavailable("")).Retryable {
+		t.Error("expected 503 on GET to stay retryable")
+	}
+	if !write("POST", RateLimited("")).Retryable {
+		t.Error("expected 429 on POST to stay retryable")
+	}
+
+	// The allowlist is configurable
+	SetRetryableOnAnyMethod(CodeUnavailable, true)
+	t.Cleanup(func() { SetRetryableOnAnyMethod(CodeUnavailable, false) })
+	if !write("POST", Unavailable("")).Retryable {
+		t.Error("expected an allowlisted code to stay retryable on POST")
+	}
+	SetRetryableOnAnyMethod(CodeRateLimited, false)
+	t.Cleanup(func() { SetRetryableOnAnyMethod(CodeRateLimited, true) })
+	if write("PATCH", RateLimited("")).Retryable {
+		t.Error("expected 429 on PATCH to be downgraded once removed from the allowlist")
+	}
+
+	// Off by default
+	RetryableForMethod = false
+	if !write("POST", Unavailable("")).Retryable {
+		t.Error("expected no downgrade when RetryableForMethod is off")
+	}
+}
+
+func TestRetryableForMethodMatrix(t *testing.T) {
+	RetryableForMethod = true
+	t.Cleanup(func() { RetryableForMethod = false })
+
+	tests := []struct {
+		method    string
+		retryable bool
+	}{
+		{http.MethodGet, true},
+		{http.MethodHead, true},
+		{http.MethodOptions, true},
+		{http.MethodTrace, true},
+		{http.MethodPut, true},
+		{http.MethodDelete, true},
+		{http.MethodPost, false},
+		{http.MethodPatch, false},
+		{http.MethodConnect, false},
+		{"PURGE", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			WriteError(w, httptest.NewRequest(tt.method, "/orders/42", nil), Unavailable(""))
+			if got := isIdempotentMethod(tt.method); got != tt.retryable {
+				t.Errorf("isIdempotentMethod(%s) = %v, want %v", tt.method, got, tt.retryable)
+			}
+			if tt.method == http.MethodHead {
+				return // no body to read
+			}
+			e, err := ReadFrom(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Retryable != tt.retryable {
+				t.Errorf("expected retryable=%v for %s, got %v", tt.retryable, tt.method, e.Retryable)
+			}
+		})
+	}
+}
+
+func TestOmitTraceIDInBody(t *testing.T) {
+	write := func(env *Envelope, accept string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(HeaderTraceID, "trace-abc")
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		env.Write(w, r, NotFound(""))
+		return w
+	}
+
+	// Included by default
+	w := write(&Envelope{}, "")
+	if !strings.Contains(w.Body.String(), `"trace_id":"trace-abc"`) {
+		t.Errorf("expected trace_id in the body, got %s", w.Body.String())
+	}
+
+	env := &Envelope{OmitTraceIDInBody: true, NegotiateProblem: true}
+	for _, accept := range []string{"", ContentTypeProblem} {
+		w := write(env, accept)
+		if strings.Contains(w.Body.String(), "trace_id") {
+			t.Errorf("expected trace_id omitted (Accept %q), got %s", accept, w.Body.String())
+		}
+		if got := w.Header().Get(HeaderTraceID); got != "trace-abc" {
+			t.Errorf("expected trace header kept (Accept %q), got %q", accept, got)
+		}
+	}
+
+	// Parse restores it from the header
+	e, err := Parse(write(env, "").Result())
+	if err != nil || e.TraceID != "trace-abc" {
+		t.Errorf("expected Parse to recover the trace ID, got %+v (%v)", e, err)
+	}
+}
+
+func TestWriteSubSecondRetryAfter(t *testing.T) {
+	tests := []struct {
+		d      time.Duration
+		body   string
+		header string
+	}{
+		{250 * time.Millisecond, "250ms", "1"},
+		{1500 * time.Millisecond, "1.5s", "2"},
+		{2 * time.Second, "2s", "2"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		Write(w, httptest.NewRequest("GET", "/", nil), RateLimited("").WithRetryAfter(tt.d))
+
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["retry_after"] != tt.body {
+			t.Errorf("%v: expected body retry_after %q, got %v", tt.d, tt.body, body["retry_after"])
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.header {
+			t.Errorf("%v: expected Retry-After %q, got %q", tt.d, tt.header, got)
+		}
+	}
+}
+
+func TestForceNonRetryable(t *testing.T) {
+	negotiateProblem(t)
+	e := Unavailable("").
+		WithRetryAfter(30*time.Second).
+		WithRetryPolicy(3, time.Second).
+		WithHeader("Retry-After", "30")
+
+	for _, accept := range []string{"", ContentTypeProblem} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/tokens/redeem", nil)
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		Write(w, r, e, ForceNonRetryable())
+
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected 503, got %d", w.Code)
+		}
+		if got := w.Header().Get("Retry-After"); got != "" {
+			t.Errorf("expected no Retry-After header (Accept %q), got %q", accept, got)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body["retryable"] != false || body["retry_after"] != nil || body["details"] != nil {
+			t.Errorf("expected no retry signals (Accept %q), got %s", accept, w.Body.String())
+		}
+	}
+
+	if !e.Retryable || e.RetryAfter != 30*time.Second || e.Headers.Get("Retry-After") != "30" {
+		t.Error("expected the caller's error unchanged")
+	}
+	if _, ok := e.RetryPolicy(); !ok {
+		t.Error("expected the caller's retry policy unchanged")
+	}
+}
+
+func TestEffectiveStatusMatchesWrite(t *testing.T) {
+	cases := []*Error{
+		NotFound("missing"),
+		RateLimited("slow down"),
+		Internal("boom"),
+		BadRequest("bad").WithStatus(http.StatusTeapot),
+		{Code: CodeInternal, Message: "no status"},
+		{Code: "CUSTOM", Message: "no status"},
+	}
+	for _, e := range cases {
+		w := httptest.NewRecorder()
+		Write(w, httptest.NewRequest("GET", "/", nil), e)
+		if got := e.EffectiveStatus(); got != w.Code {
+			t.Errorf("%s: EffectiveStatus %d, Write sent %d", e.Code, got, w.Code)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), nil)
+	if got := (*Error)(nil).EffectiveStatus(); got != w.Code {
+		t.Errorf("nil: EffectiveStatus %d, Write sent %d", got, w.Code)
+	}
+}
+
+// plainWriter is a ResponseWriter that can't flush.
+type plainWriter struct {
+	header http.Header
+	body   bytes.Buffer
+	status int
+}
+
+func (p *plainWriter) Header() http.Header         { return p.header }
+func (p *plainWriter) WriteHeader(status int)      { p.status = status }
+func (p *plainWriter) Write(b []byte) (int, error) { return p.body.Write(b) }
+
+func TestWriteFlushes(t *testing.T) {
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), Unavailable("down"))
+	if !w.Flushed {
+		t.Error("expected the body flushed")
+	}
+
+	var reported error
+	OnWriteError = func(r *http.Request, err error, clientGone bool) { reported = err }
+	t.Cleanup(func() { OnWriteError = nil })
+
+	pw := &plainWriter{header: http.Header{}}
+	Write(pw, httptest.NewRequest("GET", "/", nil), Unavailable("down"))
+	if pw.status != http.StatusServiceUnavailable || pw.body.Len() == 0 {
+		t.Errorf("expected the envelope written without a flusher, got %d %q", pw.status, pw.body.String())
+	}
+	if reported != nil {
+		t.Errorf("expected unsupported flushing ignored, got %v", reported)
+	}
+}
+
+// unwrappingWriter hides a flusher behind Unwrap, as middleware wrappers do.
+type unwrappingWriter struct{ http.ResponseWriter }
+
+func (u unwrappingWriter) Unwrap() http.ResponseWriter { return u.ResponseWriter }
+
+func TestWriteFlushesThroughUnwrap(t *testing.T) {
+	rec := httptest.NewRecorder()
+	Write(unwrappingWriter{rec}, httptest.NewRequest("GET", "/", nil), Unavailable("down"))
+	if !rec.Flushed {
+		t.Error("expected the wrapped recorder flushed")
+	}
+}
@@ -0,0 +1,73 @@
+// Package awslambda provides adapters for using err-envelope in AWS Lambda
+// functions behind API Gateway.
+package awslambda
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/aws/aws-lambda-go/events"
+	errenvelope "github.com/blackwell-systems/err-envelope"
+)
+
+// ProxyResponse converts an error into an API Gateway proxy response with
+// the envelope as its JSON body. StatusCode and Headers (Content-Type,
+// X-Request-Id, Retry-After) match what errenvelope.Write would send;
+// headers with several values (e.g. two Link headers) go in
+// MultiValueHeaders instead, so none are lost.
+// Errors are mapped with errenvelope.From; a nil error yields a 204.
+//
+// Example:
+//
+//	func handler(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+//	    user, err := findUser(ctx, req.PathParameters["id"])
+//	    if err != nil {
+//	        return awslambda.ProxyResponse(err), nil
+//	    }
+//	    // ...
+//	}
+func ProxyResponse(err error) events.APIGatewayProxyResponse {
+	w := &responseWriter{header: http.Header{}}
+	errenvelope.Write(w, nil, err)
+
+	headers := make(map[string]string, len(w.header))
+	var multi map[string][]string
+	for k, v := range w.header {
+		if len(v) == 1 {
+			headers[k] = v[0]
+			continue
+		}
+		if multi == nil {
+			multi = make(map[string][]string)
+		}
+		multi[k] = v
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode:        w.status,
+		Headers:           headers,
+		MultiValueHeaders: multi,
+		Body:              w.body.String(),
+	}
+}
+
+// responseWriter captures what errenvelope.Write produces.
+type responseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *responseWriter) Header() http.Header { return w.header }
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(b)
+}
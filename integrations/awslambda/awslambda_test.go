@@ -0,0 +1,76 @@
+package awslambda
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	errenvelope "github.com/blackwell-systems/err-envelope"
+)
+
+func TestProxyResponseNotFound(t *testing.T) {
+	resp := ProxyResponse(errenvelope.NotFound("User not found").WithTraceID("trace-123"))
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected status 404, got %d", resp.StatusCode)
+	}
+	if ct := resp.Headers["Content-Type"]; ct != errenvelope.ContentTypeJSON {
+		t.Errorf("expected Content-Type %s, got %s", errenvelope.ContentTypeJSON, ct)
+	}
+	if id := resp.Headers[errenvelope.HeaderTraceID]; id != "trace-123" {
+		t.Errorf("expected trace header trace-123, got %s", id)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		t.Fatalf("invalid JSON body: %v", err)
+	}
+	if body["code"] != "NOT_FOUND" {
+		t.Errorf("expected code NOT_FOUND, got %v", body["code"])
+	}
+	if body["message"] != "User not found" {
+		t.Errorf("expected message 'User not found', got %v", body["message"])
+	}
+	if body["trace_id"] != "trace-123" {
+		t.Errorf("expected trace_id trace-123, got %v", body["trace_id"])
+	}
+}
+
+func TestProxyResponseRetryAfter(t *testing.T) {
+	resp := ProxyResponse(errenvelope.RateLimited("").WithRetryAfter(30 * time.Second))
+
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected status 429, got %d", resp.StatusCode)
+	}
+	if ra := resp.Headers["Retry-After"]; ra != "30" {
+		t.Errorf("expected Retry-After 30, got %s", ra)
+	}
+}
+
+func TestProxyResponseMultiValueHeaders(t *testing.T) {
+	err := errenvelope.NotFound("").
+		WithHeader("Link", "</users>; rel=\"collection\"").
+		WithHelpURL("https://docs.example.com/errors/not-found")
+	resp := ProxyResponse(err)
+
+	if links := resp.MultiValueHeaders["Link"]; len(links) != 2 {
+		t.Errorf("expected both Link values in MultiValueHeaders, got %v", links)
+	}
+	if _, ok := resp.Headers["Link"]; ok {
+		t.Errorf("expected Link only in MultiValueHeaders, got %q", resp.Headers["Link"])
+	}
+	if ct := resp.Headers["Content-Type"]; ct != errenvelope.ContentTypeJSON {
+		t.Errorf("expected single-valued Content-Type in Headers, got %q", ct)
+	}
+}
+
+func TestProxyResponseNil(t *testing.T) {
+	resp := ProxyResponse(nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", resp.StatusCode)
+	}
+	if resp.Body != "" {
+		t.Errorf("expected empty body, got %s", resp.Body)
+	}
+}
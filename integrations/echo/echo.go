@@ -11,7 +11,9 @@ import (
 // Trace adapts err-envelope trace middleware to Echo's middleware interface.
 //
 // This generates or propagates trace IDs and makes them available via
-// errenvelope.TraceIDFromRequest(c.Request()).
+// errenvelope.TraceIDFromRequest(c.Request()). The X-Request-Id response header
+// is set before the handler runs, so successful responses carry it too.
+// Errors returned by the handler are passed back to Echo unchanged.
 //
 // Example:
 //
@@ -24,22 +26,31 @@ import (
 //	})
 func Trace(next echofw.HandlerFunc) echofw.HandlerFunc {
 	return func(c echofw.Context) error {
+		var err error
+
 		// Wrap with err-envelope trace middleware
 		handler := errenvelope.TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Update context with traced request
 			c.SetRequest(r)
-			_ = next(c)
+			// Echo commits headers on WriteHeader, so set it before the handler runs
+			if id := errenvelope.TraceIDFromRequest(r); id != "" {
+				c.Response().Header().Set(errenvelope.HeaderTraceID, id)
+			}
+			err = next(c)
 		}))
 
-		handler.ServeHTTP(c.Response().Writer, c.Request())
-		return nil
+		handler.ServeHTTP(c.Response(), c.Request())
+		return err
 	}
 }
 
 // Write sends a structured error response using err-envelope format.
 //
-// This is a convenience wrapper that extracts c.Response().Writer and c.Request()
-// to call errenvelope.Write.
+// This is a convenience wrapper that calls errenvelope.Write with c.Response()
+// and c.Request(). Writing through Echo's Response (rather than the raw
+// underlying writer) keeps Echo's committed/status tracking accurate and runs
+// any Response.Before hooks, so headers set by other middleware or the handler
+// (Retry-After, WWW-Authenticate, X-Request-Id) reach the client.
 //
 // Example:
 //
@@ -51,6 +62,6 @@ func Trace(next echofw.HandlerFunc) echofw.HandlerFunc {
 //	    return nil
 //	})
 func Write(c echofw.Context, err error) error {
-	errenvelope.Write(c.Response().Writer, c.Request(), err)
+	errenvelope.Write(c.Response(), c.Request(), err)
 	return nil
 }
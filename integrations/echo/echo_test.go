@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	errenvelope "github.com/blackwell-systems/err-envelope"
 	"github.com/labstack/echo/v4"
@@ -198,3 +199,117 @@ func TestWriteReturnsNil(t *testing.T) {
 	rec := httptest.NewRecorder()
 	e.ServeHTTP(rec, req)
 }
+
+func TestWriteForwardsHeaders(t *testing.T) {
+	e := echo.New()
+	e.Use(Trace)
+
+	e.GET("/limited", func(c echo.Context) error {
+		c.Response().Before(func() {
+			c.Response().Header().Set("X-Before-Hook", "ran")
+		})
+		c.Response().Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+		return Write(c, errenvelope.RateLimited("slow down").WithRetryAfter(30*time.Second))
+	})
+
+	req := httptest.NewRequest("GET", "/limited", nil)
+	req.Header.Set("X-Request-Id", "trace-echo-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After 30, got %q", got)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer realm="api"` {
+		t.Errorf("expected WWW-Authenticate to be preserved, got %q", got)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "trace-echo-1" {
+		t.Errorf("expected X-Request-Id trace-echo-1, got %q", got)
+	}
+	if got := rec.Header().Get("X-Before-Hook"); got != "ran" {
+		t.Errorf("expected Response.Before hook to run, got %q", got)
+	}
+}
+
+func TestWriteCommitsEchoResponse(t *testing.T) {
+	e := echo.New()
+
+	e.GET("/error", func(c echo.Context) error {
+		_ = Write(c, errenvelope.NotFound("not found"))
+		if !c.Response().Committed {
+			t.Error("expected echo response to be committed")
+		}
+		if c.Response().Status != http.StatusNotFound {
+			t.Errorf("expected echo response status %d, got %d", http.StatusNotFound, c.Response().Status)
+		}
+		return nil
+	})
+
+	req := httptest.NewRequest("GET", "/error", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+}
+
+func TestTraceSetsHeaderOnSuccess(t *testing.T) {
+	e := echo.New()
+	e.Use(Trace)
+
+	e.GET("/ok", func(c echo.Context) error {
+		return c.String(http.StatusOK, "hello")
+	})
+
+	req := httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set("X-Request-Id", "trace-ok-1")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "trace-ok-1" {
+		t.Errorf("expected X-Request-Id trace-ok-1, got %q", got)
+	}
+}
+
+func TestTracePropagatesHandlerError(t *testing.T) {
+	e := echo.New()
+	e.Use(Trace)
+
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusTeapot, "short and stout")
+	})
+
+	req := httptest.NewRequest("GET", "/fail", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("expected echo error handler status %d, got %d", http.StatusTeapot, rec.Code)
+	}
+	if rec.Header().Get("X-Request-Id") == "" {
+		t.Error("expected X-Request-Id header on error handler response")
+	}
+}
+
+func TestTraceSkipped(t *testing.T) {
+	errenvelope.SkipTrace = func(r *http.Request) bool { return r.URL.Path == "/healthz" }
+	t.Cleanup(func() { errenvelope.SkipTrace = nil })
+
+	e := echo.New()
+	e.Use(Trace)
+
+	e.GET("/healthz", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+
+	req := httptest.NewRequest("GET", "/healthz", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if _, ok := rec.Header()["X-Request-Id"]; ok {
+		t.Errorf("expected no X-Request-Id header for skipped path, got %q", rec.Header().Get("X-Request-Id"))
+	}
+}
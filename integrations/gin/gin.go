@@ -11,7 +11,9 @@ import (
 // Trace wires err-envelope trace ID middleware into Gin's middleware chain.
 //
 // This generates or propagates trace IDs and makes them available via
-// errenvelope.TraceIDFromRequest(c.Request).
+// errenvelope.TraceIDFromRequest(c.Request). The X-Request-Id response header
+// is set before the rest of the chain runs, so successful responses carry it
+// too (not just errors written via Write).
 //
 // Example:
 //
@@ -27,6 +29,8 @@ func Trace() gin.HandlerFunc {
 		handler := errenvelope.TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Update context with traced request
 			c.Request = r
+			// Gin commits headers on the first body write, so set it up front
+			c.Header(errenvelope.HeaderTraceID, errenvelope.TraceIDFromRequest(r))
 			c.Next()
 		}))
 
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	errenvelope "github.com/blackwell-systems/err-envelope"
 	"github.com/gin-gonic/gin"
@@ -185,3 +186,62 @@ func TestWriteUnauthorized(t *testing.T) {
 		t.Errorf("expected code UNAUTHORIZED, got %v", response["code"])
 	}
 }
+
+func TestWriteForwardsHeaders(t *testing.T) {
+	r := gin.New()
+	r.Use(Trace())
+
+	r.GET("/limited", func(c *gin.Context) {
+		c.Header("WWW-Authenticate", `Bearer realm="api"`)
+		Write(c, errenvelope.RateLimited("slow down").WithRetryAfter(30*time.Second))
+	})
+
+	req := httptest.NewRequest("GET", "/limited", nil)
+	req.Header.Set("X-Request-Id", "trace-gin-1")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("expected Retry-After 30, got %q", got)
+	}
+	if got := rec.Header().Get("WWW-Authenticate"); got != `Bearer realm="api"` {
+		t.Errorf("expected WWW-Authenticate to be preserved, got %q", got)
+	}
+	if got := rec.Header().Get("X-Request-Id"); got != "trace-gin-1" {
+		t.Errorf("expected X-Request-Id trace-gin-1, got %q", got)
+	}
+}
+
+func TestTraceSetsHeaderOnSuccess(t *testing.T) {
+	r := gin.New()
+	r.Use(Trace())
+
+	r.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "hello")
+	})
+
+	// Generated
+	req := httptest.NewRequest("GET", "/ok", nil)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Header().Get("X-Request-Id") == "" {
+		t.Error("expected X-Request-Id header on successful response")
+	}
+
+	// Propagated
+	req = httptest.NewRequest("GET", "/ok", nil)
+	req.Header.Set("X-Request-Id", "trace-ok-1")
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("X-Request-Id"); got != "trace-ok-1" {
+		t.Errorf("expected X-Request-Id trace-ok-1, got %q", got)
+	}
+}
@@ -0,0 +1,133 @@
+// Package grpc maps between err-envelope errors and gRPC status codes.
+//
+// Use it at the boundary between gRPC services and HTTP handlers (or
+// gateways) so both sides agree on error semantics.
+package grpc
+
+import (
+	"errors"
+	"sync"
+
+	errenvelope "github.com/blackwell-systems/err-envelope"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// toGRPC maps envelope codes to gRPC codes. Codes not listed map to Unknown.
+var (
+	toGRPCMu sync.RWMutex
+	toGRPC   = map[errenvelope.Code]codes.Code{
+		errenvelope.CodeInternal:            codes.Internal,
+		errenvelope.CodeBadRequest:          codes.InvalidArgument,
+		errenvelope.CodeValidationFailed:    codes.InvalidArgument,
+		errenvelope.CodeUnauthorized:        codes.Unauthenticated,
+		errenvelope.CodeForbidden:           codes.PermissionDenied,
+		errenvelope.CodeNotFound:            codes.NotFound,
+		errenvelope.CodeMethodNotAllowed:    codes.Unimplemented,
+		errenvelope.CodeNotAcceptable:       codes.InvalidArgument,
+		errenvelope.CodeGone:                codes.NotFound,
+		errenvelope.CodeConflict:            codes.AlreadyExists,
+		errenvelope.CodeLengthRequired:      codes.InvalidArgument,
+		errenvelope.CodePayloadTooLarge:     codes.InvalidArgument,
+		errenvelope.CodeUnprocessableEntity: codes.FailedPrecondition,
+		errenvelope.CodeRequestTimeout:      codes.DeadlineExceeded,
+		errenvelope.CodeRateLimited:         codes.ResourceExhausted,
+		errenvelope.CodeTimeout:             codes.DeadlineExceeded,
+		errenvelope.CodeCanceled:            codes.Canceled,
+		errenvelope.CodeUnavailable:         codes.Unavailable,
+		errenvelope.CodeDownstream:          codes.Unavailable,
+		errenvelope.CodeDownstreamTimeout:   codes.DeadlineExceeded,
+	}
+)
+
+// SetGRPCMapping overrides the gRPC code that ToGRPCStatus uses for an
+// envelope code, or adds one for a custom code, e.g.
+//
+//	errgrpc.SetGRPCMapping(errenvelope.CodeRateLimited, codes.Unavailable)
+//
+// FromGRPCStatus is unaffected. Call at startup, before serving requests;
+// it is safe to call concurrently with ToGRPCStatus.
+func SetGRPCMapping(code errenvelope.Code, grpcCode codes.Code) {
+	toGRPCMu.Lock()
+	defer toGRPCMu.Unlock()
+	toGRPC[code] = grpcCode
+}
+
+func grpcCodeFor(code errenvelope.Code) (codes.Code, bool) {
+	toGRPCMu.RLock()
+	defer toGRPCMu.RUnlock()
+	c, ok := toGRPC[code]
+	return c, ok
+}
+
+// ToGRPCStatus converts any error into a gRPC status.
+// Non-envelope errors are mapped with errenvelope.From first.
+// Returns nil for a nil error.
+func ToGRPCStatus(err error) *status.Status {
+	e := errenvelope.From(err)
+	if e == nil {
+		return nil
+	}
+	c, ok := grpcCodeFor(e.Code)
+	if !ok {
+		c = codes.Unknown
+	}
+	return status.New(c, e.Message)
+}
+
+// FromGRPCStatus converts a gRPC status into an envelope.
+// The status message becomes the envelope message, and the status
+// itself is kept as the cause. Returns nil for an OK status.
+//
+// codes.Unimplemented maps to METHOD_NOT_ALLOWED (405), the code
+// ToGRPCStatus maps back to Unimplemented.
+func FromGRPCStatus(s *status.Status) *errenvelope.Error {
+	if s == nil || s.Code() == codes.OK {
+		return nil
+	}
+
+	var e *errenvelope.Error
+	switch s.Code() {
+	case codes.Canceled:
+		e = errenvelope.New(errenvelope.CodeCanceled, errenvelope.CanceledStatus, s.Message())
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		e = errenvelope.BadRequest(s.Message())
+	case codes.DeadlineExceeded:
+		e = errenvelope.Timeout(s.Message())
+	case codes.NotFound:
+		e = errenvelope.NotFound(s.Message())
+	case codes.AlreadyExists, codes.Aborted:
+		e = errenvelope.Conflict(s.Message())
+	case codes.PermissionDenied:
+		e = errenvelope.Forbidden(s.Message())
+	case codes.Unauthenticated:
+		e = errenvelope.Unauthorized(s.Message())
+	case codes.ResourceExhausted:
+		e = errenvelope.RateLimited(s.Message())
+	case codes.Unimplemented:
+		e = errenvelope.MethodNotAllowed(s.Message())
+	case codes.Unavailable:
+		e = errenvelope.Unavailable(s.Message())
+	default: // Unknown, Internal, DataLoss
+		e = errenvelope.Internal(s.Message())
+	}
+	e.Cause = s.Err()
+	return e
+}
+
+// FromGRPC converts an error returned by a gRPC call into an envelope.
+// Envelopes pass through, gRPC status errors are mapped with FromGRPCStatus,
+// and anything else falls back to errenvelope.From.
+func FromGRPC(err error) *errenvelope.Error {
+	if err == nil {
+		return nil
+	}
+	var e *errenvelope.Error
+	if errors.As(err, &e) {
+		return errenvelope.From(e)
+	}
+	if s, ok := status.FromError(err); ok {
+		return FromGRPCStatus(s)
+	}
+	return errenvelope.From(err)
+}
@@ -0,0 +1,142 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	errenvelope "github.com/blackwell-systems/err-envelope"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestToGRPCStatus(t *testing.T) {
+	tests := []struct {
+		err  error
+		want codes.Code
+	}{
+		{errenvelope.NotFound("user not found"), codes.NotFound},
+		{errenvelope.Validation(errenvelope.FieldErrors{"email": "required"}), codes.InvalidArgument},
+		{errenvelope.Unauthorized("no token"), codes.Unauthenticated},
+		{errenvelope.RateLimited("slow down"), codes.ResourceExhausted},
+		{errenvelope.Timeout("too slow"), codes.DeadlineExceeded},
+		{errenvelope.New("CUSTOM", http.StatusTeapot, "teapot"), codes.Unknown},
+		{context.Canceled, codes.Canceled},
+		{errors.New("boom"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.err), func(t *testing.T) {
+			s := ToGRPCStatus(tt.err)
+			if s.Code() != tt.want {
+				t.Errorf("expected gRPC code %s, got %s", tt.want, s.Code())
+			}
+		})
+	}
+
+	if s := ToGRPCStatus(errenvelope.NotFound("user not found")); s.Message() != "user not found" {
+		t.Errorf("expected message to be preserved, got %s", s.Message())
+	}
+	if ToGRPCStatus(nil) != nil {
+		t.Error("expected nil status for nil error")
+	}
+}
+
+func TestFromGRPCStatus(t *testing.T) {
+	tests := []struct {
+		code       codes.Code
+		wantCode   errenvelope.Code
+		wantStatus int
+	}{
+		{codes.NotFound, errenvelope.CodeNotFound, http.StatusNotFound},
+		{codes.InvalidArgument, errenvelope.CodeBadRequest, http.StatusBadRequest},
+		{codes.AlreadyExists, errenvelope.CodeConflict, http.StatusConflict},
+		{codes.PermissionDenied, errenvelope.CodeForbidden, http.StatusForbidden},
+		{codes.Unauthenticated, errenvelope.CodeUnauthorized, http.StatusUnauthorized},
+		{codes.ResourceExhausted, errenvelope.CodeRateLimited, http.StatusTooManyRequests},
+		{codes.DeadlineExceeded, errenvelope.CodeTimeout, http.StatusGatewayTimeout},
+		{codes.Unavailable, errenvelope.CodeUnavailable, http.StatusServiceUnavailable},
+		{codes.Unimplemented, errenvelope.CodeMethodNotAllowed, http.StatusMethodNotAllowed},
+		{codes.Canceled, errenvelope.CodeCanceled, 499},
+		{codes.DataLoss, errenvelope.CodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code.String(), func(t *testing.T) {
+			e := FromGRPCStatus(status.New(tt.code, "msg"))
+			if e.Code != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, e.Code)
+			}
+			if e.Status != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, e.Status)
+			}
+			if e.Message != "msg" {
+				t.Errorf("expected message 'msg', got %s", e.Message)
+			}
+			if e.Cause == nil {
+				t.Error("expected gRPC status as cause")
+			}
+		})
+	}
+
+	if FromGRPCStatus(status.New(codes.OK, "")) != nil {
+		t.Error("expected nil for OK status")
+	}
+}
+
+func TestFromGRPC(t *testing.T) {
+	if e := FromGRPC(status.Error(codes.NotFound, "missing")); e.Code != errenvelope.CodeNotFound {
+		t.Errorf("expected NOT_FOUND, got %s", e.Code)
+	}
+
+	original := errenvelope.Conflict("duplicate")
+	if e := FromGRPC(fmt.Errorf("wrapped: %w", original)); e.Code != errenvelope.CodeConflict {
+		t.Errorf("expected envelope passthrough, got %s", e.Code)
+	}
+
+	if e := FromGRPC(errors.New("boom")); e.Code != errenvelope.CodeInternal {
+		t.Errorf("expected INTERNAL for plain error, got %s", e.Code)
+	}
+
+	if FromGRPC(nil) != nil {
+		t.Error("expected nil for nil error")
+	}
+}
+
+func TestSetGRPCMapping(t *testing.T) {
+	prev, _ := grpcCodeFor(errenvelope.CodeRateLimited)
+	t.Cleanup(func() {
+		SetGRPCMapping(errenvelope.CodeRateLimited, prev)
+		toGRPCMu.Lock()
+		defer toGRPCMu.Unlock()
+		delete(toGRPC, "QUOTA_EXCEEDED")
+	})
+
+	SetGRPCMapping(errenvelope.CodeRateLimited, codes.Unavailable)
+	if s := ToGRPCStatus(errenvelope.RateLimited("slow down")); s.Code() != codes.Unavailable {
+		t.Errorf("expected the override to apply, got %s", s.Code())
+	}
+
+	custom := errenvelope.New("QUOTA_EXCEEDED", http.StatusTooManyRequests, "quota exceeded")
+	if s := ToGRPCStatus(custom); s.Code() != codes.Unknown {
+		t.Errorf("expected Unknown before mapping a custom code, got %s", s.Code())
+	}
+	SetGRPCMapping("QUOTA_EXCEEDED", codes.ResourceExhausted)
+	if s := ToGRPCStatus(custom); s.Code() != codes.ResourceExhausted {
+		t.Errorf("expected the custom mapping, got %s", s.Code())
+	}
+}
+
+func TestGRPCRoundTrip(t *testing.T) {
+	for _, c := range []codes.Code{codes.NotFound, codes.Unimplemented, codes.Unavailable, codes.Canceled} {
+		e := FromGRPCStatus(status.New(c, "msg"))
+		if got := ToGRPCStatus(e).Code(); got != c {
+			t.Errorf("%s: round trip gave %s", c, got)
+		}
+		if again := FromGRPCStatus(ToGRPCStatus(e)); again.Code != e.Code || again.Status != e.Status {
+			t.Errorf("%s: expected a stable envelope, got %s %d then %s %d", c, e.Code, e.Status, again.Code, again.Status)
+		}
+	}
+}
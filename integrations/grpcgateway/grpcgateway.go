@@ -0,0 +1,81 @@
+// Package grpcgateway provides a grpc-gateway error handler that writes
+// err-envelope responses instead of the gateway's default error body.
+package grpcgateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	errenvelope "github.com/blackwell-systems/err-envelope"
+	errgrpc "github.com/blackwell-systems/err-envelope/integrations/grpc"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrorHandler is a runtime.ErrorHandlerFunc that converts gRPC errors
+// into envelopes and writes them with errenvelope.Write.
+//
+// The gRPC status is mapped via the grpc integration, so a codes.NotFound
+// RPC error becomes a NOT_FOUND envelope at 404. Gateway routing errors
+// keep the HTTP status chosen by the gateway, with the code that matches
+// it, e.g. METHOD_NOT_ALLOWED for a 405. The trace ID is taken from
+// the RPC's response metadata (x-request-id) when present, then from the
+// outgoing request metadata, then from the HTTP request as usual.
+//
+// Example:
+//
+//	mux := runtime.NewServeMux(
+//	    runtime.WithErrorHandler(grpcgateway.ErrorHandler),
+//	)
+func ErrorHandler(ctx context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	var e *errenvelope.Error
+
+	var httpErr *runtime.HTTPStatusError
+	if errors.As(err, &httpErr) {
+		e = errgrpc.FromGRPC(httpErr.Err)
+		if e == nil {
+			// No underlying RPC error; describe the status alone
+			e = errenvelope.Status(httpErr.HTTPStatus, "")
+		}
+		e = e.WithStatus(httpErr.HTTPStatus)
+		if errenvelope.StatusForCode(e.Code) != e.Status {
+			// Keep the code in step with the status the gateway chose
+			e.Code = errenvelope.CodeForStatus(e.Status)
+		}
+	} else {
+		e = errgrpc.FromGRPC(err)
+	}
+
+	if e.TraceID == "" {
+		if id := traceIDFromMetadata(ctx); id != "" {
+			e = e.WithTraceID(id)
+		}
+	}
+
+	errenvelope.Write(w, r, e)
+}
+
+var _ runtime.ErrorHandlerFunc = ErrorHandler
+
+// traceIDFromMetadata looks for the trace header in gRPC metadata.
+// Metadata keys are lowercase, so X-Request-Id is x-request-id.
+func traceIDFromMetadata(ctx context.Context) string {
+	key := strings.ToLower(errenvelope.HeaderTraceID)
+
+	if md, ok := runtime.ServerMetadataFromContext(ctx); ok {
+		if v := md.HeaderMD.Get(key); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+		if v := md.TrailerMD.Get(key); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if v := md.Get(key); len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,138 @@
+package grpcgateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorHandlerNotFound(t *testing.T) {
+	ctx := runtime.NewServerMetadataContext(context.Background(), runtime.ServerMetadata{
+		HeaderMD: metadata.Pairs("x-request-id", "trace-grpc-1"),
+	})
+
+	req := httptest.NewRequest("GET", "/v1/users/42", nil)
+	rec := httptest.NewRecorder()
+	ErrorHandler(ctx, nil, nil, rec, req, status.Error(codes.NotFound, "user not found"))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response["code"] != "NOT_FOUND" {
+		t.Errorf("expected code NOT_FOUND, got %v", response["code"])
+	}
+	if response["message"] != "user not found" {
+		t.Errorf("expected message 'user not found', got %v", response["message"])
+	}
+	if response["trace_id"] != "trace-grpc-1" {
+		t.Errorf("expected trace_id from metadata, got %v", response["trace_id"])
+	}
+	if rec.Header().Get("X-Request-Id") != "trace-grpc-1" {
+		t.Errorf("expected X-Request-Id header from metadata, got %s", rec.Header().Get("X-Request-Id"))
+	}
+}
+
+func TestErrorHandlerOutgoingMetadata(t *testing.T) {
+	ctx := metadata.NewOutgoingContext(context.Background(), metadata.Pairs("x-request-id", "trace-out"))
+
+	rec := httptest.NewRecorder()
+	ErrorHandler(ctx, nil, nil, rec, httptest.NewRequest("GET", "/", nil), status.Error(codes.Unavailable, "down"))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, rec.Code)
+	}
+	if rec.Header().Get("X-Request-Id") != "trace-out" {
+		t.Errorf("expected trace from outgoing metadata, got %s", rec.Header().Get("X-Request-Id"))
+	}
+}
+
+func TestErrorHandlerRoutingError(t *testing.T) {
+	mux := runtime.NewServeMux(runtime.WithErrorHandler(ErrorHandler))
+
+	req := httptest.NewRequest("GET", "/no/such/route", nil)
+	req.Header.Set("X-Request-Id", "trace-route")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, rec.Code)
+	}
+
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response["code"] != "NOT_FOUND" {
+		t.Errorf("expected code NOT_FOUND, got %v", response["code"])
+	}
+	if response["trace_id"] != "trace-route" {
+		t.Errorf("expected trace_id from request header, got %v", response["trace_id"])
+	}
+}
+
+func TestErrorHandlerHTTPStatusError(t *testing.T) {
+	err := &runtime.HTTPStatusError{
+		HTTPStatus: http.StatusMethodNotAllowed,
+		Err:        status.Error(codes.Unimplemented, "Method Not Allowed"),
+	}
+
+	rec := httptest.NewRecorder()
+	ErrorHandler(context.Background(), nil, nil, rec, httptest.NewRequest("POST", "/", nil), err)
+
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status %d, got %d", http.StatusMethodNotAllowed, rec.Code)
+	}
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if response["code"] != "METHOD_NOT_ALLOWED" {
+		t.Errorf("expected code METHOD_NOT_ALLOWED, got %v", response["code"])
+	}
+}
+
+func TestErrorHandlerHTTPStatusErrorRemapsCode(t *testing.T) {
+	// The gateway answers 404 for an unknown route, whatever the inner code
+	err := &runtime.HTTPStatusError{
+		HTTPStatus: http.StatusNotFound,
+		Err:        status.Error(codes.Internal, "Not Found"),
+	}
+
+	rec := httptest.NewRecorder()
+	ErrorHandler(context.Background(), nil, nil, rec, httptest.NewRequest("GET", "/nope", nil), err)
+
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusNotFound || response["code"] != "NOT_FOUND" {
+		t.Errorf("expected 404 NOT_FOUND, got %d %v", rec.Code, response["code"])
+	}
+}
+
+func TestErrorHandlerHTTPStatusErrorNilErr(t *testing.T) {
+	err := &runtime.HTTPStatusError{HTTPStatus: http.StatusMethodNotAllowed}
+
+	rec := httptest.NewRecorder()
+	ErrorHandler(context.Background(), nil, nil, rec, httptest.NewRequest("PUT", "/", nil), err)
+
+	var response map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if rec.Code != http.StatusMethodNotAllowed || response["code"] != "METHOD_NOT_ALLOWED" {
+		t.Errorf("expected 405 METHOD_NOT_ALLOWED, got %d %v", rec.Code, response["code"])
+	}
+}
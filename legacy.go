@@ -0,0 +1,52 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// legacyShape is the flat body understood by older clients.
+type legacyShape struct {
+	ErrorCode   Code   `json:"error_code"`
+	ErrorDetail string `json:"error_detail"`
+}
+
+// ToLegacy renders the error in the flat legacy shape:
+//
+//	{"error_code": "NOT_FOUND", "error_detail": "User not found"}
+//
+// This is a compatibility shim for clients that predate the envelope.
+// Only the code and message are carried; details, trace ID, and retry
+// signals are dropped from the body. Prefer Write for new endpoints.
+func ToLegacy(e *Error) []byte {
+	if e == nil {
+		return nil
+	}
+	b, _ := json.Marshal(legacyShape{ErrorCode: e.Code, ErrorDetail: e.Message})
+	return b
+}
+
+// WriteLegacy writes the error in the legacy shape (see ToLegacy).
+// Status and headers (trace ID, Retry-After) match Write, so only the
+// body differs. Use it on the specific endpoints legacy clients call.
+func WriteLegacy(w http.ResponseWriter, r *http.Request, err error) {
+	defaultEnvelope().WriteLegacy(w, r, err)
+}
+
+// WriteLegacy is like the package-level WriteLegacy, using env's configuration.
+func (env *Envelope) WriteLegacy(w http.ResponseWriter, r *http.Request, err error) {
+	e := env.From(err)
+	if e == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	e = env.acquire(e, r)
+	defer Release(e)
+	status := env.prepare(w, e)
+
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+
+	env.writeBody(w, r, append(ToLegacy(e), '\n'))
+}
@@ -0,0 +1,51 @@
+package errenvelope
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestToLegacy(t *testing.T) {
+	got := string(ToLegacy(NotFound("User not found").WithDetails(map[string]any{"id": 42})))
+	want := `{"error_code":"NOT_FOUND","error_detail":"User not found"}`
+	if got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	if ToLegacy(nil) != nil {
+		t.Error("expected nil for nil error")
+	}
+}
+
+func TestWriteLegacy(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/v1/user", nil)
+	r.Header.Set(HeaderTraceID, "trace-legacy")
+
+	WriteLegacy(w, r, Unauthorized("Missing token"))
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+	if id := w.Header().Get(HeaderTraceID); id != "trace-legacy" {
+		t.Errorf("expected trace header trace-legacy, got %s", id)
+	}
+
+	want := `{"error_code":"UNAUTHORIZED","error_detail":"Missing token"}` + "\n"
+	if w.Body.String() != want {
+		t.Errorf("expected body %q, got %q", want, w.Body.String())
+	}
+}
+
+func TestWriteLegacyNil(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteLegacy(w, httptest.NewRequest("GET", "/", nil), nil)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("expected status %d, got %d", http.StatusNoContent, w.Code)
+	}
+}
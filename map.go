@@ -2,18 +2,86 @@ package errenvelope
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"time"
 )
 
 // FieldErrors is a simple, library-agnostic validation shape.
 type FieldErrors map[string]string
 
 // ValidationDetails holds field-level validation errors.
+// Messages lists every message per field, in order, when the error was
+// built with ValidationBuilder or ValidationMulti; Fields then holds them
+// joined with FieldMessageSeparator for clients expecting one string.
 type ValidationDetails struct {
-	Fields FieldErrors `json:"fields"`
+	Fields   FieldErrors         `json:"fields"`
+	Messages map[string][]string `json:"messages,omitempty"`
+}
+
+// TimeoutSource identifies where a timeout originated.
+// It is stored in Details under "timeout_source" by the timeout constructors.
+type TimeoutSource string
+
+const (
+	// TimeoutClient is the client's own deadline (408, RequestTimeout).
+	TimeoutClient TimeoutSource = "client"
+	// TimeoutInternal is our own processing deadline (504, Timeout).
+	TimeoutInternal TimeoutSource = "internal"
+	// TimeoutDownstream is a deadline on a downstream call (504, DownstreamTimeout).
+	TimeoutDownstream TimeoutSource = "downstream"
+)
+
+// RateLimitScope says which limit a 429 hit, so clients know whether
+// backing off helps them specifically. It is stored in Details under
+// "scope" by RateLimitedScope.
+type RateLimitScope string
+
+const (
+	// RateLimitClient is a per-client limit; this client should back off.
+	RateLimitClient RateLimitScope = "client"
+	// RateLimitGlobal is a service-wide cap shared by all clients.
+	RateLimitGlobal RateLimitScope = "global"
+	// RateLimitEndpoint is a limit on one endpoint; others are unaffected.
+	RateLimitEndpoint RateLimitScope = "endpoint"
+)
+
+// timeoutSource returns the timeout source recorded in details, if any.
+func timeoutSource(e *Error) TimeoutSource {
+	d, ok := e.Details.(map[string]any)
+	if !ok {
+		return ""
+	}
+	switch src := d["timeout_source"].(type) {
+	case TimeoutSource:
+		return src
+	case string: // after a JSON round-trip
+		return TimeoutSource(src)
+	}
+	return ""
+}
+
+// Status creates an error for an arbitrary HTTP status, using the
+// built-in code that best describes it (unlisted 4xx statuses map to
+// BAD_REQUEST, everything else to INTERNAL). If msg is empty and the
+// code's canonical status differs, the status text is used, so
+// Status(418, "") says "I'm a teapot" rather than "Bad request".
+func Status(status int, msg string) *Error {
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	code := CodeForStatus(status)
+	e := New(code, status, msg)
+	if msg == "" && StatusForCode(code) != status {
+		if text := http.StatusText(status); text != "" {
+			e.Message = text
+		}
+	}
+	return e
 }
 
 // Internal creates an internal server error (500).
@@ -56,6 +124,17 @@ func Unauthorizedf(format string, args ...any) *Error {
 	return Unauthorized(fmt.Sprintf(format, args...))
 }
 
+// UnauthorizedOpaque creates an unauthorized error (401) for public auth
+// endpoints. Its message is always "Unauthorized", with no details and no
+// error ID, so every failure (unknown user, wrong password, expired
+// token) produces the same body and clients can't tell them apart. Log
+// the real reason server-side; use Unauthorized for internal APIs.
+func UnauthorizedOpaque() *Error {
+	e := Unauthorized("Unauthorized")
+	e.ErrorID = ""
+	return e
+}
+
 // Forbidden creates a forbidden error (403).
 func Forbidden(msg string) *Error {
 	return New(CodeForbidden, http.StatusForbidden, msg).
@@ -67,6 +146,15 @@ func Forbiddenf(format string, args ...any) *Error {
 	return Forbidden(fmt.Sprintf(format, args...))
 }
 
+// ForbiddenOpaque creates a forbidden error (403) with the fixed message
+// "Forbidden", no details, and no error ID, so responses don't reveal why
+// access was denied. See UnauthorizedOpaque.
+func ForbiddenOpaque() *Error {
+	e := Forbidden("Forbidden")
+	e.ErrorID = ""
+	return e
+}
+
 // NotFound creates a not found error (404).
 func NotFound(msg string) *Error {
 	return New(CodeNotFound, http.StatusNotFound, msg).
@@ -89,16 +177,84 @@ func Conflictf(format string, args ...any) *Error {
 	return Conflict(fmt.Sprintf(format, args...))
 }
 
+// VersionConflict creates a conflict error (409) for a failed optimistic
+// concurrency check, e.g. a stale ETag or row version. Both versions go
+// in details as expected_version and actual_version, so clients can
+// refetch and retry. If msg is empty, "Resource version conflict" is used.
+func VersionConflict(expected, actual string, msg string) *Error {
+	if msg == "" {
+		msg = "Resource version conflict"
+	}
+	return Conflict(msg).WithDetails(map[string]any{
+		"expected_version": expected,
+		"actual_version":   actual,
+	})
+}
+
+// DuplicateField creates a conflict error (409) for a unique-constraint
+// violation, e.g. an email that is already registered. Details carry the
+// colliding field, plus the value when non-empty; pass "" to keep a
+// sensitive value out of the response. The message is "<field> already
+// exists".
+func DuplicateField(field, value string) *Error {
+	d := map[string]any{"field": field}
+	if value != "" {
+		d["value"] = value
+	}
+	msg := "Resource already exists"
+	if field != "" {
+		msg = field + " already exists"
+	}
+	return Conflict(msg).WithDetails(d)
+}
+
+// HeaderIdempotencyReplayed marks a response to a replayed idempotent request.
+const HeaderIdempotencyReplayed = "Idempotency-Replayed"
+
+// ReplayedConflict creates a conflict error (409) for a request whose
+// Idempotency-Key was already used. Write sets Idempotency-Replayed: true
+// and Content-Location: location, pointing at the original result, and
+// details carry original_request_id. Services that answer replays with
+// 200 plus the marker can override the status with WithStatus(http.StatusOK).
+func ReplayedConflict(location, originalID string) *Error {
+	e := Conflict("Request was already processed").
+		WithHeader(HeaderIdempotencyReplayed, "true")
+	if location != "" {
+		e = e.WithHeader("Content-Location", location)
+	}
+	d := map[string]any{}
+	if originalID != "" {
+		d["original_request_id"] = originalID
+	}
+	if location != "" {
+		d["location"] = location
+	}
+	if len(d) > 0 {
+		e = e.WithDetails(d)
+	}
+	return e
+}
+
 // MethodNotAllowed creates a method not allowed error (405).
 func MethodNotAllowed(msg string) *Error {
 	return New(CodeMethodNotAllowed, http.StatusMethodNotAllowed, msg).
 		WithRetryable(false)
 }
 
+// NotAcceptable creates a not acceptable error (406).
+// Write produces it automatically when StrictAccept is enabled and the
+// request's Accept header rules out every supported media type.
+func NotAcceptable(msg string) *Error {
+	return New(CodeNotAcceptable, http.StatusNotAcceptable, msg).
+		WithRetryable(false)
+}
+
 // RequestTimeout creates a request timeout error (408).
 // This is for client-side timeouts, distinct from 504 Gateway Timeout.
+// Details record timeout_source "client".
 func RequestTimeout(msg string) *Error {
 	return New(CodeRequestTimeout, http.StatusRequestTimeout, msg).
+		WithDetails(map[string]any{"timeout_source": TimeoutClient}).
 		WithRetryable(true)
 }
 
@@ -108,6 +264,13 @@ func Gone(msg string) *Error {
 		WithRetryable(false)
 }
 
+// LengthRequired creates a length required error (411).
+// Use when a request body is required but Content-Length was not declared.
+func LengthRequired(msg string) *Error {
+	return New(CodeLengthRequired, http.StatusLengthRequired, msg).
+		WithRetryable(false)
+}
+
 // PayloadTooLarge creates a payload too large error (413).
 func PayloadTooLarge(msg string) *Error {
 	return New(CodePayloadTooLarge, http.StatusRequestEntityTooLarge, msg).
@@ -127,9 +290,17 @@ func RateLimited(msg string) *Error {
 		WithRetryable(true)
 }
 
-// Timeout creates a timeout error (504).
+// RateLimitedScope creates a rate limit error (429) recording which limit
+// was hit in details under "scope".
+func RateLimitedScope(scope RateLimitScope, msg string) *Error {
+	return RateLimited(msg).withDetail("scope", scope)
+}
+
+// Timeout creates a timeout error (504) for our own processing deadline.
+// Details record timeout_source "internal".
 func Timeout(msg string) *Error {
 	return New(CodeTimeout, http.StatusGatewayTimeout, msg).
+		WithDetails(map[string]any{"timeout_source": TimeoutInternal}).
 		WithRetryable(true)
 }
 
@@ -149,34 +320,275 @@ func Unavailablef(format string, args ...any) *Error {
 	return Unavailable(fmt.Sprintf(format, args...))
 }
 
+// ExposeDownstreamCause adds a sanitized summary of the cause to the
+// details of Downstream and DownstreamTimeout errors, so clients can see
+// what the downstream service returned. Only structured fields are
+// exposed: "downstream_code" and "downstream_status" when the cause is an
+// *Error, or "downstream_status" when it reports a StatusCode() int (e.g.
+// an error built from an *http.Response). Raw cause strings are never
+// included. Off by default. Set once at startup.
+var ExposeDownstreamCause bool
+
+// NameDownstreamService puts the service name in the default message of
+// Downstream and DownstreamTimeout errors, e.g. "payments service error"
+// instead of "Downstream service error". The "service" detail is set
+// either way. Off by default, since internal service names may not be
+// meant for clients. Set once at startup.
+var NameDownstreamService bool
+
+// downstreamMessage returns the default message for a downstream error,
+// or "" to use the code's default.
+func downstreamMessage(service, suffix string) string {
+	if !NameDownstreamService || service == "" {
+		return ""
+	}
+	return service + " service " + suffix
+}
+
+// addDownstreamCause records the sanitized cause summary in d.
+func addDownstreamCause(d map[string]any, cause error) {
+	if !ExposeDownstreamCause || cause == nil {
+		return
+	}
+	var e *Error
+	if errors.As(cause, &e) {
+		d["downstream_code"] = e.Code
+		if e.Status != 0 {
+			d["downstream_status"] = e.Status
+		}
+		return
+	}
+	var sc interface{ StatusCode() int }
+	if errors.As(cause, &sc) {
+		d["downstream_status"] = sc.StatusCode()
+	}
+}
+
+// DownstreamTimeoutCtx is DownstreamTimeout with the caller's context,
+// recording whether the downstream was slow or we ran out of time.
+// Details gain the timeout configured for the downstream call, in
+// milliseconds, as "timeout_ms" (omitted when timeout is 0),
+// "parent_deadline_exceeded" (true when ctx's own deadline had already
+// passed) and, if ctx has a deadline, the remaining budget as
+// "parent_budget_remaining" (e.g. "0s" or "1.5s").
+func DownstreamTimeoutCtx(ctx context.Context, service string, timeout time.Duration, cause error) *Error {
+	e := DownstreamTimeout(service, cause)
+	d := e.Details.(map[string]any)
+	if timeout > 0 {
+		d["timeout_ms"] = timeout.Milliseconds()
+	}
+	d["parent_deadline_exceeded"] = errors.Is(ctx.Err(), context.DeadlineExceeded)
+	if deadline, ok := ctx.Deadline(); ok {
+		remaining := deadline.Sub(now())
+		if remaining < 0 {
+			remaining = 0
+		}
+		d["parent_budget_remaining"] = remaining.String()
+	}
+	return e
+}
+
+// Maintenance creates an unavailable error (503) for planned maintenance.
+// Details carry the window as RFC 3339 UTC timestamps ("maintenance_start",
+// "maintenance_end") so clients can show "back at 14:00 UTC", and
+// RetryAt is set to end, so Write sends the time remaining when the
+// response is written as the Retry-After header; a shared maintenance
+// error counts down. If msg is empty, "Service under maintenance" is used.
+func Maintenance(start, end time.Time, msg string) *Error {
+	if msg == "" {
+		msg = "Service under maintenance"
+	}
+	e := Unavailable(msg).WithDetails(map[string]any{
+		"maintenance_start": start.UTC().Format(time.RFC3339),
+		"maintenance_end":   end.UTC().Format(time.RFC3339),
+	}).WithRetryAt(end)
+	return e
+}
+
 // Downstream creates an error for downstream service failures (502).
 func Downstream(service string, cause error) *Error {
 	d := map[string]any{}
 	if service != "" {
 		d["service"] = service
 	}
-	return Wrap(CodeDownstream, http.StatusBadGateway, "", cause).
+	addDownstreamCause(d, cause)
+	return Wrap(CodeDownstream, http.StatusBadGateway, downstreamMessage(service, "error"), cause).
 		WithDetails(d).
 		WithRetryable(true)
 }
 
 // DownstreamTimeout creates a timeout error for downstream services (504).
+// Details record timeout_source "downstream".
 func DownstreamTimeout(service string, cause error) *Error {
-	d := map[string]any{}
+	d := map[string]any{"timeout_source": TimeoutDownstream}
 	if service != "" {
 		d["service"] = service
 	}
-	return Wrap(CodeDownstreamTimeout, http.StatusGatewayTimeout, "", cause).
+	addDownstreamCause(d, cause)
+	return Wrap(CodeDownstreamTimeout, http.StatusGatewayTimeout, downstreamMessage(service, "timed out"), cause).
 		WithDetails(d).
 		WithRetryable(true)
 }
 
+// NewForRequest is New plus the usual request enrichment: the trace ID
+// from r (see TraceIDFromRequest), and the request method and path (no
+// query string) in details as "method" and "path". A nil r yields a plain
+// New error. Use New for errors outside HTTP handlers.
+func NewForRequest(r *http.Request, code Code, status int, msg string) *Error {
+	return defaultEnvelope().NewForRequest(r, code, status, msg)
+}
+
+// NewForRequest is like the package-level NewForRequest, reading env's
+// trace header.
+func (env *Envelope) NewForRequest(r *http.Request, code Code, status int, msg string) *Error {
+	e := New(code, status, msg)
+	if r == nil {
+		return e
+	}
+	e.TraceID = env.TraceIDFromRequest(r)
+	d := map[string]any{"method": r.Method}
+	if r.URL != nil {
+		d["path"] = r.URL.Path
+	}
+	e.Details = d
+	return e
+}
+
+// FromContext maps err like From and stamps the trace ID from ctx (set by
+// TraceMiddleware or WithTraceID) onto it right away, instead of waiting
+// for Write. Use it when logging an error before writing it. An existing
+// trace ID on the error is kept. The caller's error is never mutated.
+func FromContext(ctx context.Context, err error) *Error {
+	e := From(err)
+	if e == nil || e.TraceID != "" {
+		return e
+	}
+	if id := traceIDFromContext(ctx); id != "" {
+		return e.WithTraceID(id)
+	}
+	return e
+}
+
+// FromWith maps err like From, then applies opts to a copy, composing
+// mapping and request-scoped enrichment in one call:
+//
+//	e := errenvelope.FromWith(err, func(e *errenvelope.Error) {
+//	    e.TraceID = traceID
+//	})
+//
+// The caller's *Error is never mutated by the options. Options are
+// applied to a shallow copy, so to change details, assign a new value
+// (e.g. via WithDetails) rather than modifying the existing map.
+// Returns nil for a nil err.
+func FromWith(err error, opts ...func(*Error)) *Error {
+	e := From(err)
+	if e == nil {
+		return nil
+	}
+	c := *e
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return &c
+}
+
+// joinedErrors returns the branches of the first joined error in err's
+// chain if at least two of them carry an *Error. It returns nil if the
+// join has fewer, or if an *Error (which From uses as-is) or the end of
+// the chain comes first.
+func joinedErrors(err error) []error {
+	for err != nil {
+		switch x := err.(type) {
+		case *Error:
+			return nil
+		case interface{ Unwrap() []error }:
+			branches := x.Unwrap()
+			n := 0
+			for _, b := range branches {
+				var e *Error
+				if errors.As(b, &e) {
+					n++
+				}
+			}
+			if n < 2 {
+				return nil
+			}
+			return branches
+		}
+		err = errors.Unwrap(err)
+	}
+	return nil
+}
+
+// FromPanic converts a value returned by recover() into an envelope, with
+// the stack of the panicking goroutine attached via WithStack. Errors are
+// mapped with From, strings become Internal(v), and any other value
+// becomes Internal("panic: <value>"). Returns nil for a nil value.
+//
+// String and other values end up in the message, which is sent to the
+// client; call Public on the result, as RecoverMiddleware does, when the
+// panic value must stay private.
+//
+//	defer func() {
+//	    if v := recover(); v != nil {
+//	        e := errenvelope.FromPanic(v)
+//	        slog.Error("panic", "error", e, "stack", string(e.Stack))
+//	        errenvelope.Write(w, r, e.Public())
+//	    }
+//	}()
+func FromPanic(v any) *Error {
+	var e *Error
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case error:
+		e = From(v)
+	case string:
+		e = Internal(v)
+	default:
+		e = Internal(fmt.Sprintf("panic: %v", v))
+	}
+	return e.WithStack()
+}
+
+// CanceledStatus is the HTTP status used for CodeCanceled, including
+// From(context.Canceled). It defaults to 499, the nginx convention for
+// "client closed request". Set it to a standard status (e.g. 400 or 408)
+// at startup if your load balancer or tooling mishandles 499.
+var CanceledStatus = 499
+
 // From maps arbitrary errors into an *Error.
-// Handles context errors, network timeouts, and wraps unknown errors.
+// Handles context errors, network timeouts, DNS failures, and wraps unknown errors.
+//
+// DNS lookup failures (*net.DNSError, typically wrapped in a *url.Error
+// from an HTTP client) map to Unavailable. A host that does not exist
+// is not retryable; temporary resolver failures are. The hostname is
+// kept in the cause for logs, not exposed in the response.
+//
+// TLS failures talking to a downstream host also map to Unavailable,
+// with the cause kept for logs. Certificate verification errors
+// (x509.UnknownAuthorityError, x509.CertificateInvalidError,
+// x509.HostnameError, *tls.CertificateVerificationError) are
+// configuration problems and not retryable; other handshake failures
+// (tls.RecordHeaderError, tls.AlertError) are.
+//
+// *http.MaxBytesError, returned when a body read through
+// http.MaxBytesReader exceeds its limit, maps to PayloadTooLarge (413)
+// with the limit in bytes as details.max_bytes.
+//
+// Joined errors (errors.Join, or fmt.Errorf with several %w verbs) with
+// envelopes in two or more branches map to a Multi of the branches, so
+// the most severe status wins and every child code is kept, instead of
+// only the first envelope errors.As finds. Other joins are mapped as
+// below, e.g. joining a plain error with context.DeadlineExceeded still
+// yields Timeout.
 func From(err error) *Error {
 	if err == nil {
 		return nil
 	}
+	if branches := joinedErrors(err); branches != nil {
+		return Multi(branches...)
+	}
 
 	var e *Error
 	if errors.As(err, &e) {
@@ -185,7 +597,7 @@ func From(err error) *Error {
 			e.Status = http.StatusInternalServerError
 		}
 		if e.Message == "" {
-			e.Message = defaultMessage(e.Code)
+			e.Message = defaultMessageFor(e.Code, e.Status)
 		}
 		return e
 	}
@@ -195,7 +607,7 @@ func From(err error) *Error {
 		return Timeout("")
 	}
 	if errors.Is(err, context.Canceled) {
-		return New(CodeCanceled, 499, "").WithRetryable(false) // 499 is common convention
+		return New(CodeCanceled, CanceledStatus, "").WithRetryable(false)
 	}
 
 	// net.Error timeouts
@@ -204,7 +616,58 @@ func From(err error) *Error {
 		return Timeout("")
 	}
 
+	// DNS failures
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		e := Unavailable("Downstream host could not be resolved")
+		e.Cause = err
+		if dnsErr.IsNotFound {
+			e.Retryable = false
+			e.Transient = false
+		}
+		return e
+	}
+
+	// TLS handshake and certificate failures
+	if e := fromTLS(err); e != nil {
+		return e
+	}
+
+	// Request body over http.MaxBytesReader's limit
+	var mbErr *http.MaxBytesError
+	if errors.As(err, &mbErr) {
+		e := PayloadTooLarge("").WithDetails(map[string]any{"max_bytes": mbErr.Limit})
+		e.Cause = err
+		return e
+	}
+
 	// Default
 	return Wrap(CodeInternal, http.StatusInternalServerError, "", err).
 		WithRetryable(false)
 }
+
+// fromTLS maps TLS handshake and certificate errors, or returns nil.
+func fromTLS(err error) *Error {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		invalidCert      x509.CertificateInvalidError
+		hostname         x509.HostnameError
+		verification     *tls.CertificateVerificationError
+		recordHeader     tls.RecordHeaderError
+		alert            tls.AlertError
+	)
+	var e *Error
+	switch {
+	case errors.As(err, &unknownAuthority), errors.As(err, &invalidCert),
+		errors.As(err, &hostname), errors.As(err, &verification):
+		e = Unavailable("Downstream certificate could not be verified")
+		e.Retryable = false
+		e.Transient = false
+	case errors.As(err, &recordHeader), errors.As(err, &alert):
+		e = Unavailable("Downstream TLS handshake failed")
+	default:
+		return nil
+	}
+	e.Cause = err
+	return e
+}
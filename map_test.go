@@ -1,10 +1,19 @@
 package errenvelope
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
 	"time"
 )
@@ -176,6 +185,28 @@ func TestGone(t *testing.T) {
 	}
 }
 
+func TestLengthRequired(t *testing.T) {
+	err := LengthRequired("Content-Length header is required")
+
+	if err.Code != CodeLengthRequired {
+		t.Errorf("expected code %s, got %s", CodeLengthRequired, err.Code)
+	}
+	if err.Status != http.StatusLengthRequired {
+		t.Errorf("expected status %d, got %d", http.StatusLengthRequired, err.Status)
+	}
+	if err.Message != "Content-Length header is required" {
+		t.Errorf("expected message 'Content-Length header is required', got %s", err.Message)
+	}
+	if err.Retryable {
+		t.Error("length required should not be retryable")
+	}
+
+	// Default message
+	if msg := LengthRequired("").Message; msg != "Length required" {
+		t.Errorf("expected default message 'Length required', got %s", msg)
+	}
+}
+
 func TestPayloadTooLarge(t *testing.T) {
 	err := PayloadTooLarge("upload exceeds 10MB limit")
 
@@ -278,6 +309,50 @@ func TestDownstream(t *testing.T) {
 	}
 }
 
+type statusCodeError struct{ code int }
+
+func (e statusCodeError) Error() string   { return fmt.Sprintf("upstream returned %d", e.code) }
+func (e statusCodeError) StatusCode() int { return e.code }
+
+func TestDownstreamExposeCause(t *testing.T) {
+	cause := NotFound("account acct_123 missing in ledger db")
+
+	// Off by default: nothing about the cause reaches the details
+	details := Downstream("ledger", cause).Details.(map[string]any)
+	if _, ok := details["downstream_code"]; ok {
+		t.Error("expected no downstream summary by default")
+	}
+
+	ExposeDownstreamCause = true
+	t.Cleanup(func() { ExposeDownstreamCause = false })
+
+	details = Downstream("ledger", fmt.Errorf("calling ledger: %w", cause)).Details.(map[string]any)
+	if details["downstream_code"] != CodeNotFound {
+		t.Errorf("expected downstream_code NOT_FOUND, got %v", details["downstream_code"])
+	}
+	if details["downstream_status"] != http.StatusNotFound {
+		t.Errorf("expected downstream_status 404, got %v", details["downstream_status"])
+	}
+	for k, v := range details {
+		if s, ok := v.(string); ok && strings.Contains(s, "acct_123") {
+			t.Errorf("cause message leaked into details[%s]", k)
+		}
+	}
+
+	details = DownstreamTimeout("ledger", statusCodeError{code: 503}).Details.(map[string]any)
+	if details["downstream_status"] != 503 {
+		t.Errorf("expected downstream_status 503, got %v", details["downstream_status"])
+	}
+	if details["timeout_source"] != TimeoutDownstream {
+		t.Error("expected timeout_source to be kept")
+	}
+
+	details = Downstream("ledger", errors.New("connection refused")).Details.(map[string]any)
+	if len(details) != 1 {
+		t.Errorf("expected only service for an opaque cause, got %v", details)
+	}
+}
+
 func TestDownstreamTimeout(t *testing.T) {
 	cause := errors.New("deadline exceeded")
 	err := DownstreamTimeout("payments", cause)
@@ -301,6 +376,42 @@ func TestDownstreamTimeout(t *testing.T) {
 	}
 }
 
+func TestTimeoutSource(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *Error
+		want TimeoutSource
+	}{
+		{"RequestTimeout", RequestTimeout("client too slow"), TimeoutClient},
+		{"Timeout", Timeout("query took too long"), TimeoutInternal},
+		{"Timeoutf", Timeoutf("query exceeded %dms", 500), TimeoutInternal},
+		{"DownstreamTimeout", DownstreamTimeout("payments", errors.New("deadline")), TimeoutDownstream},
+		{"From(DeadlineExceeded)", From(context.DeadlineExceeded), TimeoutInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, ok := tt.err.Details.(map[string]any)
+			if !ok {
+				t.Fatal("expected map details")
+			}
+			if details["timeout_source"] != tt.want {
+				t.Errorf("expected timeout_source %s, got %v", tt.want, details["timeout_source"])
+			}
+
+			var buf bytes.Buffer
+			slog.New(slog.NewJSONHandler(&buf, nil)).Info("timeout", "error", tt.err)
+			if !strings.Contains(buf.String(), `"timeout_source":"`+string(tt.want)+`"`) {
+				t.Errorf("expected timeout_source in log output, got %s", buf.String())
+			}
+		})
+	}
+
+	if src := timeoutSource(Internal("boom")); src != "" {
+		t.Errorf("expected no timeout source for non-timeout error, got %s", src)
+	}
+}
+
 func TestFromNil(t *testing.T) {
 	err := From(nil)
 	if err != nil {
@@ -351,6 +462,29 @@ func (timeoutError) Error() string   { return "timeout" }
 func (timeoutError) Timeout() bool   { return true }
 func (timeoutError) Temporary() bool { return true }
 
+func TestCanceledStatusConfigurable(t *testing.T) {
+	CanceledStatus = http.StatusRequestTimeout
+	t.Cleanup(func() { CanceledStatus = 499 })
+
+	err := From(context.Canceled)
+	if err.Status != http.StatusRequestTimeout {
+		t.Errorf("expected status %d, got %d", http.StatusRequestTimeout, err.Status)
+	}
+	if err.Code != CodeCanceled {
+		t.Errorf("expected code %s, got %s", CodeCanceled, err.Code)
+	}
+	if got := StatusForCode(CodeCanceled); got != http.StatusRequestTimeout {
+		t.Errorf("expected StatusForCode(CodeCanceled) %d, got %d", http.StatusRequestTimeout, got)
+	}
+
+	// Wrapped cancellation flows through Write
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), fmt.Errorf("query: %w", context.Canceled))
+	if w.Code != http.StatusRequestTimeout {
+		t.Errorf("expected written status %d, got %d", http.StatusRequestTimeout, w.Code)
+	}
+}
+
 func TestFromNetError(t *testing.T) {
 	var netErr net.Error = timeoutError{}
 	err := From(netErr)
@@ -384,6 +518,45 @@ func TestFromGenericError(t *testing.T) {
 	}
 }
 
+func TestFromDNSError(t *testing.T) {
+	tests := []struct {
+		name      string
+		dnsErr    *net.DNSError
+		wantCode  Code
+		retryable bool
+	}{
+		{"not found", &net.DNSError{Err: "no such host", Name: "api.internal", IsNotFound: true}, CodeUnavailable, false},
+		{"temporary", &net.DNSError{Err: "server misbehaving", Name: "api.internal", IsTemporary: true}, CodeUnavailable, true},
+		{"timeout", &net.DNSError{Err: "i/o timeout", Name: "api.internal", IsTimeout: true}, CodeTimeout, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// HTTP clients wrap resolver errors in *url.Error
+			wrapped := &url.Error{Op: "Get", URL: "http://api.internal/users", Err: &net.OpError{Op: "dial", Net: "tcp", Err: tt.dnsErr}}
+			e := From(wrapped)
+
+			if e.Code != tt.wantCode {
+				t.Errorf("expected code %s, got %s", tt.wantCode, e.Code)
+			}
+			if e.Retryable != tt.retryable {
+				t.Errorf("expected retryable=%v, got %v", tt.retryable, e.Retryable)
+			}
+			if tt.wantCode == CodeUnavailable {
+				if e.Status != http.StatusServiceUnavailable {
+					t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, e.Status)
+				}
+				if strings.Contains(e.Message, "api.internal") {
+					t.Errorf("hostname should not leak into message: %s", e.Message)
+				}
+				if !errors.Is(e, wrapped) {
+					t.Error("expected cause to be preserved")
+				}
+			}
+		})
+	}
+}
+
 func TestFromWrappedDeadline(t *testing.T) {
 	// Test wrapped context.DeadlineExceeded
 	wrapped := errors.Join(errors.New("outer"), context.DeadlineExceeded)
@@ -413,3 +586,538 @@ func TestFromActualNetTimeout(t *testing.T) {
 		}
 	}
 }
+
+func TestNotAcceptable(t *testing.T) {
+	err := NotAcceptable("")
+
+	if err.Code != CodeNotAcceptable {
+		t.Errorf("expected code %s, got %s", CodeNotAcceptable, err.Code)
+	}
+	if err.Status != http.StatusNotAcceptable {
+		t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, err.Status)
+	}
+	if err.Message != "Not acceptable" {
+		t.Errorf("expected default message 'Not acceptable', got %s", err.Message)
+	}
+	if err.Retryable {
+		t.Error("not acceptable should not be retryable")
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	fixed := time.Date(2026, 3, 1, 13, 30, 0, 0, time.UTC)
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+
+	start := fixed.Add(-30 * time.Minute)
+	end := time.Date(2026, 3, 1, 14, 0, 0, 0, time.UTC)
+	e := Maintenance(start, end, "")
+
+	if e.Code != CodeUnavailable || e.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected UNAVAILABLE/503, got %s/%d", e.Code, e.Status)
+	}
+	if !e.Retryable {
+		t.Error("maintenance should be retryable")
+	}
+	if e.Message != "Service under maintenance" {
+		t.Errorf("expected default message, got %s", e.Message)
+	}
+	if !e.RetryAt.Equal(end) {
+		t.Errorf("expected RetryAt %v, got %v", end, e.RetryAt)
+	}
+
+	details := e.Details.(map[string]any)
+	if details["maintenance_start"] != "2026-03-01T13:00:00Z" {
+		t.Errorf("unexpected maintenance_start: %v", details["maintenance_start"])
+	}
+	if details["maintenance_end"] != "2026-03-01T14:00:00Z" {
+		t.Errorf("unexpected maintenance_end: %v", details["maintenance_end"])
+	}
+
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), e)
+	if got := w.Header().Get("Retry-After"); got != "1800" {
+		t.Errorf("expected Retry-After 1800, got %s", got)
+	}
+
+	// The same error counts down as the clock advances
+	now = func() time.Time { return fixed.Add(20 * time.Minute) }
+	w = httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), e)
+	if got := w.Header().Get("Retry-After"); got != "600" {
+		t.Errorf("expected Retry-After 600 ten minutes before the end, got %s", got)
+	}
+	now = func() time.Time { return fixed }
+
+	// A window that already ended sends no retry hint
+	past := Maintenance(start, fixed.Add(-time.Minute), "Back soon")
+	w = httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), past)
+	if got := w.Header().Get("Retry-After"); got != "" || past.Message != "Back soon" {
+		t.Errorf("expected no Retry-After and custom message, got %q / %s", got, past.Message)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	ctx := WithTraceID(context.Background(), "ctx-trace")
+
+	e := FromContext(ctx, errors.New("db down"))
+	if e.TraceID != "ctx-trace" {
+		t.Errorf("expected context trace ID, got %q", e.TraceID)
+	}
+	if e.Code != CodeInternal {
+		t.Errorf("expected INTERNAL, got %s", e.Code)
+	}
+
+	// Existing trace IDs win, and shared errors aren't mutated
+	own := NotFound("x").WithTraceID("own-trace")
+	if got := FromContext(ctx, own); got.TraceID != "own-trace" {
+		t.Errorf("expected existing trace ID kept, got %q", got.TraceID)
+	}
+	if got := FromContext(ctx, ErrNotFound); got.TraceID != "ctx-trace" || ErrNotFound.TraceID != "" {
+		t.Errorf("expected stamped copy, got %q (sentinel %q)", got.TraceID, ErrNotFound.TraceID)
+	}
+
+	if FromContext(ctx, nil) != nil {
+		t.Error("expected nil for nil error")
+	}
+	if got := FromContext(context.Background(), errors.New("x")); got.TraceID != "" {
+		t.Errorf("expected no trace ID without one in context, got %q", got.TraceID)
+	}
+}
+
+func TestDownstreamTimeoutCtx(t *testing.T) {
+	fixed := time.Now()
+	now = func() time.Time { return fixed }
+	t.Cleanup(func() { now = time.Now })
+
+	// We ran out of time: the parent deadline already fired
+	expired, cancel := context.WithDeadline(context.Background(), fixed.Add(-time.Second))
+	defer cancel()
+	e := DownstreamTimeoutCtx(expired, "payments", 2*time.Second, context.DeadlineExceeded)
+	d := e.Details.(map[string]any)
+	if d["parent_deadline_exceeded"] != true {
+		t.Errorf("expected parent_deadline_exceeded true, got %v", d["parent_deadline_exceeded"])
+	}
+	if d["timeout_ms"] != int64(2000) {
+		t.Errorf("expected timeout_ms 2000, got %v", d["timeout_ms"])
+	}
+	if d["parent_budget_remaining"] != "0s" {
+		t.Errorf("expected zero remaining budget, got %v", d["parent_budget_remaining"])
+	}
+	if e.Code != CodeDownstreamTimeout || d["service"] != "payments" || d["timeout_source"] != TimeoutDownstream {
+		t.Errorf("expected DownstreamTimeout details kept, got %s %v", e.Code, d)
+	}
+
+	// Downstream was slow: the parent still has budget
+	live, cancel2 := context.WithDeadline(context.Background(), fixed.Add(90*time.Minute))
+	defer cancel2()
+	d = DownstreamTimeoutCtx(live, "payments", 1500*time.Millisecond, errors.New("client timeout")).Details.(map[string]any)
+	if d["parent_deadline_exceeded"] != false {
+		t.Errorf("expected parent_deadline_exceeded false, got %v", d["parent_deadline_exceeded"])
+	}
+	if d["timeout_ms"] != int64(1500) {
+		t.Errorf("expected timeout_ms 1500, got %v", d["timeout_ms"])
+	}
+	if d["parent_budget_remaining"] != "1h30m0s" {
+		t.Errorf("expected 1h30m0s remaining, got %v", d["parent_budget_remaining"])
+	}
+
+	// No parent deadline: no budget recorded
+	d = DownstreamTimeoutCtx(context.Background(), "", 0, errors.New("slow")).Details.(map[string]any)
+	if _, ok := d["timeout_ms"]; ok {
+		t.Errorf("expected no timeout_ms for an unknown timeout, got %v", d["timeout_ms"])
+	}
+	if _, ok := d["parent_budget_remaining"]; ok || d["parent_deadline_exceeded"] != false {
+		t.Errorf("unexpected details without a deadline: %v", d)
+	}
+}
+
+func TestVersionConflict(t *testing.T) {
+	e := VersionConflict("7", "9", "")
+	if e.Code != CodeConflict || e.Status != http.StatusConflict || e.Retryable {
+		t.Errorf("expected non-retryable 409 conflict, got %s %d %v", e.Code, e.Status, e.Retryable)
+	}
+	if e.Message != "Resource version conflict" {
+		t.Errorf("unexpected default message %q", e.Message)
+	}
+	d := e.Details.(map[string]any)
+	if d["expected_version"] != "7" || d["actual_version"] != "9" {
+		t.Errorf("expected both versions in details, got %v", d)
+	}
+
+	if e := VersionConflict("a", "b", "Order was modified"); e.Message != "Order was modified" {
+		t.Errorf("expected custom message, got %q", e.Message)
+	}
+}
+
+func TestReplayedConflict(t *testing.T) {
+	e := ReplayedConflict("/orders/42", "req-original")
+
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("POST", "/orders", nil), e)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+	if got := w.Header().Get(HeaderIdempotencyReplayed); got != "true" {
+		t.Errorf("expected replay marker, got %q", got)
+	}
+	if got := w.Header().Get("Content-Location"); got != "/orders/42" {
+		t.Errorf("expected Content-Location, got %q", got)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentTypeJSON {
+		t.Errorf("expected envelope content type, got %q", got)
+	}
+	if d := e.Details.(map[string]any); d["original_request_id"] != "req-original" {
+		t.Errorf("expected original ID in details, got %v", d)
+	}
+
+	// 200 with the marker instead of 409
+	w = httptest.NewRecorder()
+	Write(w, httptest.NewRequest("POST", "/orders", nil), e.WithStatus(http.StatusOK))
+	if w.Code != http.StatusOK || w.Header().Get(HeaderIdempotencyReplayed) != "true" {
+		t.Errorf("expected 200 with replay marker, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestWithHeaderCopies(t *testing.T) {
+	base := Conflict("").WithHeader("X-One", "1")
+	derived := base.WithHeader("X-Two", "2")
+	if base.Headers.Get("X-Two") != "" {
+		t.Error("expected WithHeader not to mutate the original")
+	}
+	if derived.Headers.Get("X-One") != "1" || derived.Headers.Get("X-Two") != "2" {
+		t.Errorf("expected both headers on the copy, got %v", derived.Headers)
+	}
+
+	// Headers Write manages win over custom ones
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), derived.WithHeader("Content-Type", "text/plain").WithTraceID("t-1").WithHeader(HeaderTraceID, "spoofed"))
+	if got := w.Header().Get("Content-Type"); got != ContentTypeJSON {
+		t.Errorf("expected managed Content-Type, got %q", got)
+	}
+	if got := w.Header().Get(HeaderTraceID); got != "t-1" {
+		t.Errorf("expected managed trace header, got %q", got)
+	}
+}
+
+func TestFromWith(t *testing.T) {
+	orig := NotFound("User not found").WithDetails(map[string]any{"id": "42"})
+
+	e := FromWith(orig,
+		func(e *Error) { e.TraceID = "trace-req" },
+		func(e *Error) { e.Details = map[string]any{"id": "42", "tenant": "acme"} },
+	)
+	if e == orig {
+		t.Fatal("expected a copy")
+	}
+	if e.TraceID != "trace-req" || e.Details.(map[string]any)["tenant"] != "acme" {
+		t.Errorf("expected options applied, got %+v", e)
+	}
+	if orig.TraceID != "" || len(orig.Details.(map[string]any)) != 1 {
+		t.Errorf("expected the original unchanged, got %+v", orig)
+	}
+
+	// Plain errors are mapped first
+	if e := FromWith(errors.New("boom"), func(e *Error) { e.Hint = "retry later" }); e.Code != CodeInternal || e.Hint != "retry later" {
+		t.Errorf("unexpected mapping: %+v", e)
+	}
+	if FromWith(nil, func(e *Error) { t.Error("option called for nil error") }) != nil {
+		t.Error("expected nil for nil error")
+	}
+}
+
+func TestTransientDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *Error
+		transient bool
+	}{
+		{"unavailable", Unavailable(""), true},
+		{"timeout", Timeout(""), true},
+		{"rate limited", RateLimited(""), true},
+		{"downstream", Downstream("payments", nil), true},
+		{"downstream timeout", DownstreamTimeout("payments", nil), true},
+		{"conflict", Conflict(""), false},
+		{"retryable conflict", Conflict("").WithRetryable(true), false},
+		{"not found", NotFound(""), false},
+		{"internal", Internal(""), false},
+		{"override", Unavailable("").WithTransient(false), false},
+		{"dns not found", From(&net.DNSError{Err: "no such host", Name: "db.internal", IsNotFound: true}), false},
+	}
+	for _, tt := range tests {
+		if tt.err.Transient != tt.transient {
+			t.Errorf("%s: expected transient %v, got %v", tt.name, tt.transient, tt.err.Transient)
+		}
+	}
+
+	// Surfaced in JSON only when set
+	data, _ := json.Marshal(Unavailable(""))
+	if !bytes.Contains(data, []byte(`"transient":true`)) {
+		t.Errorf("expected transient in JSON, got %s", data)
+	}
+	data, _ = json.Marshal(Conflict(""))
+	if bytes.Contains(data, []byte(`"transient"`)) {
+		t.Errorf("expected transient omitted when false, got %s", data)
+	}
+}
+
+func TestRateLimitedScope(t *testing.T) {
+	for _, scope := range []RateLimitScope{RateLimitClient, RateLimitGlobal, RateLimitEndpoint} {
+		e := RateLimitedScope(scope, "")
+		if e.Status != http.StatusTooManyRequests || e.Code != CodeRateLimited || !e.Retryable {
+			t.Errorf("%s: expected retryable 429, got %d %s %v", scope, e.Status, e.Code, e.Retryable)
+		}
+		if d := e.Details.(map[string]any); d["scope"] != scope {
+			t.Errorf("expected scope %s, got %v", scope, d["scope"])
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Write(w, httptest.NewRequest("GET", "/", nil), RateLimitedScope(RateLimitGlobal, "Service is at capacity"))
+	if !strings.Contains(w.Body.String(), `"scope":"global"`) || w.Code != http.StatusTooManyRequests {
+		t.Errorf("expected scope in the body, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestStatus(t *testing.T) {
+	e := Status(http.StatusTeapot, "")
+	if e.Status != http.StatusTeapot || e.Code != CodeBadRequest {
+		t.Errorf("expected 418 BAD_REQUEST, got %d %s", e.Status, e.Code)
+	}
+	if e.Message != "I'm a teapot" {
+		t.Errorf("expected teapot message, got %q", e.Message)
+	}
+
+	// Statuses with a dedicated code keep the code's message and defaults
+	if e := Status(http.StatusServiceUnavailable, ""); e.Code != CodeUnavailable || e.Message != "Service unavailable" || !e.Retryable {
+		t.Errorf("unexpected 503: %+v", e)
+	}
+	if e := Status(http.StatusTeapot, "Short and stout"); e.Message != "Short and stout" {
+		t.Errorf("expected explicit message kept, got %q", e.Message)
+	}
+
+	// Unknown codes fall back to the status text instead of "Internal error"
+	if e := New("BREWING", http.StatusTeapot, ""); e.Message != "I'm a teapot" {
+		t.Errorf("expected status text for an unknown code, got %q", e.Message)
+	}
+	if e := New("BREWING", 0, ""); e.Message != "Internal Server Error" {
+		t.Errorf("expected 500 status text, got %q", e.Message)
+	}
+}
+
+func TestNameDownstreamService(t *testing.T) {
+	if e := Downstream("payments", nil); e.Message != "Downstream service error" {
+		t.Errorf("expected generic message by default, got %q", e.Message)
+	}
+
+	NameDownstreamService = true
+	t.Cleanup(func() { NameDownstreamService = false })
+
+	e := Downstream("payments", errors.New("502 from payments"))
+	if e.Message != "payments service error" {
+		t.Errorf("expected named message, got %q", e.Message)
+	}
+	if e.Details.(map[string]any)["service"] != "payments" {
+		t.Error("expected the service detail kept")
+	}
+	if e := DownstreamTimeout("ledger", nil); e.Message != "ledger service timed out" {
+		t.Errorf("expected named timeout message, got %q", e.Message)
+	}
+	if e := Downstream("", nil); e.Message != "Downstream service error" {
+		t.Errorf("expected generic message without a service, got %q", e.Message)
+	}
+}
+
+func TestFromPanic(t *testing.T) {
+	if FromPanic(nil) != nil {
+		t.Error("expected nil for a nil value")
+	}
+
+	e := FromPanic(NotFound("user 42"))
+	if e.Code != CodeNotFound || e.Message != "user 42" {
+		t.Errorf("expected *Error kept, got %s %q", e.Code, e.Message)
+	}
+	if e := FromPanic(context.DeadlineExceeded); e.Code != CodeTimeout {
+		t.Errorf("expected errors mapped with From, got %s", e.Code)
+	}
+
+	e = FromPanic("nil map write")
+	if e.Code != CodeInternal || e.Message != "nil map write" {
+		t.Errorf("expected Internal with the string, got %s %q", e.Code, e.Message)
+	}
+
+	e = FromPanic(42)
+	if e.Code != CodeInternal || e.Message != "panic: 42" {
+		t.Errorf("expected formatted panic value, got %s %q", e.Code, e.Message)
+	}
+	if !bytes.Contains(e.Stack, []byte("TestFromPanic")) {
+		t.Errorf("expected the caller's stack, got %s", e.Stack)
+	}
+	if pub := e.Public(); pub.Message == "panic: 42" {
+		t.Error("expected Public to hide the panic value")
+	}
+	b, _ := json.Marshal(e)
+	if bytes.Contains(b, []byte("goroutine")) {
+		t.Errorf("stack leaked to JSON: %s", b)
+	}
+}
+
+func TestDuplicateField(t *testing.T) {
+	e := DuplicateField("email", "a@example.com")
+	if e.Status != http.StatusConflict || e.Code != CodeConflict {
+		t.Errorf("expected 409 CONFLICT, got %d %s", e.Status, e.Code)
+	}
+	if e.Message != "email already exists" {
+		t.Errorf("unexpected message %q", e.Message)
+	}
+	d := e.Details.(map[string]any)
+	if d["field"] != "email" || d["value"] != "a@example.com" {
+		t.Errorf("unexpected details: %v", d)
+	}
+
+	if _, ok := DuplicateField("email", "").Details.(map[string]any)["value"]; ok {
+		t.Error("expected no value detail for an empty value")
+	}
+	if e := DuplicateField("", ""); e.Message != "Resource already exists" {
+		t.Errorf("expected generic message without a field, got %q", e.Message)
+	}
+}
+
+func TestFromMaxBytesError(t *testing.T) {
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader(`{"name":"a very long name"}`))
+	w := httptest.NewRecorder()
+	body := http.MaxBytesReader(w, r.Body, 8)
+	var v map[string]any
+	err := json.NewDecoder(body).Decode(&v)
+	if err == nil {
+		t.Fatal("expected the body limit to be exceeded")
+	}
+
+	e := From(fmt.Errorf("decode body: %w", err))
+	if e.Code != CodePayloadTooLarge || e.Status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected 413 PAYLOAD_TOO_LARGE, got %d %s", e.Status, e.Code)
+	}
+	if got := e.Details.(map[string]any)["max_bytes"]; got != int64(8) {
+		t.Errorf("expected max_bytes 8, got %v", got)
+	}
+	if !errors.Is(e, err) {
+		t.Error("expected the cause kept")
+	}
+}
+
+func TestFromJoined(t *testing.T) {
+	joined := errors.Join(BadRequest("bad cursor"), Internal("db down"))
+	e := From(fmt.Errorf("list orders: %w", joined))
+	if e.Status != http.StatusInternalServerError || e.Code != CodeInternal {
+		t.Fatalf("expected a 500-classed result, got %d %s", e.Status, e.Code)
+	}
+	children := e.Details.(map[string]any)["errors"].([]*Error)
+	if len(children) != 2 || children[0].Code != CodeBadRequest || children[0].Message != "bad cursor" {
+		t.Errorf("expected the 400 kept as a child, got %v", children)
+	}
+	var bad *Error
+	if !errors.As(e.Cause, &bad) || bad.Code != CodeBadRequest {
+		t.Error("expected the join kept as the cause")
+	}
+
+	// A join with a single envelope maps as before
+	if e := From(errors.Join(errors.New("note"), NotFound("x"))); e.Code != CodeNotFound {
+		t.Errorf("expected NOT_FOUND, got %s", e.Code)
+	}
+	// An envelope wrapping a join is used as-is
+	wrapped := Wrap(CodeConflict, http.StatusConflict, "", joined)
+	if e := From(wrapped); e != wrapped {
+		t.Errorf("expected the outer envelope, got %+v", e)
+	}
+}
+
+func TestNewForRequest(t *testing.T) {
+	r := httptest.NewRequest("DELETE", "/users/42?token=secret", nil)
+	r.Header.Set(HeaderTraceID, "trace-req")
+
+	e := NewForRequest(r, CodeNotFound, http.StatusNotFound, "User not found")
+	if e.Code != CodeNotFound || e.Status != http.StatusNotFound || e.Message != "User not found" {
+		t.Errorf("unexpected error: %+v", e)
+	}
+	if e.TraceID != "trace-req" {
+		t.Errorf("expected the request trace ID, got %q", e.TraceID)
+	}
+	d := e.Details.(map[string]any)
+	if d["path"] != "/users/42" || d["method"] != "DELETE" {
+		t.Errorf("expected method and path without the query, got %v", d)
+	}
+
+	env := &Envelope{TraceHeader: "X-Trace-Id"}
+	r.Header.Set("X-Trace-Id", "trace-env")
+	if e := env.NewForRequest(r, CodeConflict, http.StatusConflict, ""); e.TraceID != "trace-env" {
+		t.Errorf("expected the envelope's trace header, got %q", e.TraceID)
+	}
+	if e := NewForRequest(nil, CodeInternal, 500, ""); e.TraceID != "" || e.Details != nil {
+		t.Errorf("expected a plain error for a nil request, got %+v", e)
+	}
+}
+
+func TestOpaqueAuthErrors(t *testing.T) {
+	body := func(e *Error) string {
+		w := httptest.NewRecorder()
+		Write(w, httptest.NewRequest("POST", "/login", nil), e)
+		return w.Body.String()
+	}
+
+	tests := []struct {
+		name   string
+		make   func() *Error
+		status int
+		want   string
+	}{
+		{"unauthorized", UnauthorizedOpaque, http.StatusUnauthorized, `{"code":"UNAUTHORIZED","message":"Unauthorized","retryable":false}`},
+		{"forbidden", ForbiddenOpaque, http.StatusForbidden, `{"code":"FORBIDDEN","message":"Forbidden","retryable":false}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := body(tt.make())
+			if first != tt.want+"\n" {
+				t.Errorf("unexpected body %s", first)
+			}
+			for i := 0; i < 3; i++ {
+				if got := body(tt.make()); got != first {
+					t.Errorf("expected identical bodies, got %s and %s", first, got)
+				}
+			}
+			if e := tt.make(); e.Status != tt.status || e.Details != nil {
+				t.Errorf("unexpected error: %+v", e)
+			}
+		})
+	}
+}
+
+func TestFromTLSError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"unknown authority", x509.UnknownAuthorityError{}, false},
+		{"invalid certificate", x509.CertificateInvalidError{Reason: x509.Expired}, false},
+		{"verification", &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}, false},
+		{"record header", tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wrapped := &url.Error{Op: "Get", URL: "https://api.internal/users", Err: tt.err}
+			e := From(wrapped)
+			if e.Code != CodeUnavailable || e.Status != http.StatusServiceUnavailable {
+				t.Errorf("expected 503 UNAVAILABLE, got %d %s", e.Status, e.Code)
+			}
+			if e.Retryable != tt.retryable || e.Transient != tt.retryable {
+				t.Errorf("expected retryable=transient=%v, got %v/%v", tt.retryable, e.Retryable, e.Transient)
+			}
+			if !errors.Is(e, wrapped) {
+				t.Error("expected the TLS error kept as the cause")
+			}
+		})
+	}
+}
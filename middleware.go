@@ -1,53 +1,484 @@
 package errenvelope
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ctxKey string
 
-const traceKey ctxKey = "errenvelope.trace_id"
+const (
+	traceKey       ctxKey = "errenvelope.trace_id"
+	forcedTraceKey ctxKey = "errenvelope.forced_trace_id"
+	hopsKey        ctxKey = "errenvelope.hops"
+)
+
+// TraceIDExtractor, if set, supplies a trace ID when the request has none
+// in its header or context, e.g. a request ID claim from a parsed JWT:
+//
+//	errenvelope.TraceIDExtractor = func(r *http.Request) string {
+//	    if claims, ok := auth.ClaimsFrom(r.Context()); ok {
+//	        return claims.RequestID
+//	    }
+//	    return ""
+//	}
+//
+// TraceMiddleware only generates a new ID when it returns "". Set once at startup.
+var TraceIDExtractor func(r *http.Request) string
+
+// SpanIDExtractor, if set, supplies the current span ID for errors that
+// don't carry one, e.g. from an OpenTelemetry span in the request context:
+//
+//	errenvelope.SpanIDExtractor = func(r *http.Request) string {
+//	    if sc := trace.SpanContextFromContext(r.Context()); sc.HasSpanID() {
+//	        return sc.SpanID().String()
+//	    }
+//	    return ""
+//	}
+//
+// Pair it with a TraceIDExtractor reading sc.TraceID() so both IDs come
+// from the same span context. Set once at startup.
+var SpanIDExtractor func(r *http.Request) string
+
+// SkipTrace, if set, makes TraceMiddleware pass matching requests through
+// untouched, without generating a trace ID, e.g. for high-frequency
+// health probes:
+//
+//	errenvelope.SkipTrace = func(r *http.Request) bool {
+//	    return r.URL.Path == "/healthz" || r.URL.Path == "/metrics"
+//	}
+//
+// Nil (the default) skips nothing. Set once at startup.
+var SkipTrace func(r *http.Request) bool
 
-// TraceIDFromRequest extracts the trace ID from the request header or context.
+// TraceHeaderOrder, if set, lists the request headers TraceIDFromRequest
+// reads a trace ID from, in order of precedence; the first present one
+// wins. A W3C "traceparent" entry yields the trace-id part of that header.
+// Nil (the default) reads only the trace header (HeaderTraceID). Responses
+// always carry the ID in the trace header. Set once at startup:
+//
+//	errenvelope.TraceHeaderOrder = []string{"traceparent", "X-B3-TraceId", "X-Request-Id", "X-Correlation-Id"}
+var TraceHeaderOrder []string
+
+// TraceIDFromRequest extracts the trace ID from the request header (see
+// TraceHeaderOrder) or context, falling back to TraceIDExtractor.
 func TraceIDFromRequest(r *http.Request) string {
+	return defaultEnvelope().TraceIDFromRequest(r)
+}
+
+// TraceIDFromRequest is like the package-level TraceIDFromRequest, reading
+// env's trace header.
+func (env *Envelope) TraceIDFromRequest(r *http.Request) string {
 	if r == nil {
 		return ""
 	}
-	// Prefer header
-	if id := r.Header.Get(HeaderTraceID); id != "" {
+	// Prefer headers
+	if id := env.traceIDFromHeaders(r.Header); id != "" {
 		return id
 	}
 	// Then context
-	if v := r.Context().Value(traceKey); v != nil {
-		if s, ok := v.(string); ok {
-			return s
+	if id := traceIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	// Then the custom extractor
+	if env.TraceIDExtractor != nil {
+		return env.TraceIDExtractor(r)
+	}
+	return ""
+}
+
+func (env *Envelope) traceIDFromHeaders(h http.Header) string {
+	if env.TraceHeaderOrder == nil {
+		return h.Get(env.traceHeader())
+	}
+	for _, name := range env.TraceHeaderOrder {
+		id := h.Get(name)
+		if strings.EqualFold(name, "traceparent") {
+			id = traceIDFromTraceparent(id)
+		}
+		if id != "" {
+			return id
 		}
 	}
 	return ""
 }
 
+// traceIDFromTraceparent returns the trace-id of a W3C traceparent header
+// ("00-<trace-id>-<parent-id>-<flags>"), or "" if it is malformed or the
+// all-zero invalid ID.
+func traceIDFromTraceparent(v string) string {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || parts[1] == strings.Repeat("0", 32) {
+		return ""
+	}
+	if _, err := hex.DecodeString(parts[1]); err != nil {
+		return ""
+	}
+	return strings.ToLower(parts[1])
+}
+
+func traceIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	if s, ok := ctx.Value(forcedTraceKey).(string); ok && s != "" {
+		return s
+	}
+	if s, ok := ctx.Value(traceKey).(string); ok {
+		return s
+	}
+	return ""
+}
+
 // WithTraceID adds a trace ID to the context.
 func WithTraceID(ctx context.Context, id string) context.Context {
 	return context.WithValue(ctx, traceKey, id)
 }
 
+// WithForcedTraceID pins the trace ID for requests carrying ctx, so tests
+// can assert on it without replacing the generator. TraceMiddleware,
+// Write, and FromContext use it ahead of any other context ID, the
+// TraceIDExtractor, and generation; an inbound trace header still wins.
+// TraceMiddleware resolves it once and stores only the chosen ID, so
+// handlers behind it see the same ID as the response.
+//
+//	r = r.WithContext(errenvelope.WithForcedTraceID(r.Context(), "trace-test"))
+//	handler.ServeHTTP(w, r) // the envelope carries trace_id "trace-test"
+func WithForcedTraceID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, forcedTraceKey, id)
+}
+
 // TraceMiddleware generates or propagates a trace ID for each request.
 func TraceMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := r.Header.Get(HeaderTraceID)
-		if id == "" {
-			id = newTraceID()
+		defaultEnvelope().serveTraced(next, w, r)
+	})
+}
+
+// TraceMiddleware is like the package-level TraceMiddleware, reading
+// env's trace header.
+func (env *Envelope) TraceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		env.serveTraced(next, w, r)
+	})
+}
+
+func (env *Envelope) serveTraced(next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if env.SkipTrace != nil && env.SkipTrace(r) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	// Header, then a forced ID, then other context IDs and the extractor
+	id := env.TraceIDFromRequest(r)
+	if id == "" {
+		id = newTraceID()
+	}
+	// Store only the resolved ID: a forced ID the header overrode must not
+	// resurface in FromContext further down.
+	ctx := context.WithValue(WithTraceID(r.Context(), id), forcedTraceKey, "")
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Chain composes middleware so the first argument is the outermost layer:
+// Chain(a, b, c)(h) is equivalent to a(b(c(h))).
+//
+// The recommended order is trace outermost, recover inside it, and timeout
+// innermost, so recovered panics and timeouts are both written with the
+// request's trace ID:
+//
+//	handler := errenvelope.Chain(
+//	    errenvelope.TraceMiddleware,
+//	    errenvelope.RecoverMiddleware,
+//	    errenvelope.TimeoutMiddleware(5*time.Second),
+//	)(mux)
+func Chain(mws ...func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		for i := len(mws) - 1; i >= 0; i-- {
+			h = mws[i](h)
 		}
-		ctx := WithTraceID(r.Context(), id)
+		return h
+	}
+}
+
+// RecoverMiddleware converts panics into envelopes with FromPanic: a
+// panic with an *Error (e.g. panic(errenvelope.NotFound(""))) writes that
+// error, and any other value an INTERNAL envelope (500). The panic value
+// and stack are logged with slog; server errors are written with Public,
+// so neither reaches the client. If the handler already started the
+// response, the envelope can't be written and the connection is aborted
+// instead. http.ErrAbortHandler is re-panicked so net/http can abort the
+// response as intended.
+func RecoverMiddleware(next http.Handler) http.Handler {
+	return defaultEnvelope().RecoverMiddleware(next)
+}
+
+// RecoverMiddleware is like the package-level RecoverMiddleware, writing with env.
+func (env *Envelope) RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sw := &statusWriter{ResponseWriter: w}
+		defer func() {
+			v := recover()
+			if v == nil {
+				return
+			}
+			if v == http.ErrAbortHandler {
+				panic(v)
+			}
+
+			e := FromPanic(v)
+			slog.ErrorContext(r.Context(), "errenvelope: recovered panic",
+				"error", e,
+				"stack", string(e.Stack),
+			)
+			if sw.wrote {
+				panic(http.ErrAbortHandler)
+			}
+			env.Write(w, r, e.Public())
+		}()
+		next.ServeHTTP(sw, r)
+	})
+}
+
+// TimeoutMiddleware bounds each request's context with a deadline of d.
+// The handler runs on the request goroutine, so panics still reach
+// RecoverMiddleware; handlers must honor ctx.Done() to stop early. If the
+// deadline passes and the handler returns without writing a response, a
+// TIMEOUT envelope (504) is written for it.
+func TimeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return defaultEnvelope().TimeoutMiddleware(d)
+}
+
+// TimeoutMiddleware is like the package-level TimeoutMiddleware, writing with env.
+func (env *Envelope) TimeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			sw := &statusWriter{ResponseWriter: w}
+			r = r.WithContext(ctx)
+			next.ServeHTTP(sw, r)
+
+			if !sw.wrote && ctx.Err() == context.DeadlineExceeded {
+				env.Write(w, r, Timeout(""))
+			}
+		})
+	}
+}
+
+// LatencyMiddleware times each request and adds the elapsed time so far,
+// in milliseconds, to the details of any error written for it as
+// "elapsed_ms" (see ContextWithDetail). Successful responses are
+// unaffected. Place it outermost to time the whole chain. It has no
+// configuration, so it serves any Envelope as well.
+func LatencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ctx := ContextWithDetail(r.Context(), "elapsed_ms", DetailFunc(func() any {
+			return time.Since(start).Milliseconds()
+		}))
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// HeaderRequestHops counts how many services a request has passed through.
+const HeaderRequestHops = "X-Request-Hops"
+
+// HopLimitMiddleware detects routing loops in a service mesh. It reads
+// the X-Request-Hops header, increments it, and answers with an INTERNAL
+// envelope (500) "request loop detected" once the count exceeds maxHops.
+// Otherwise the incremented count replaces the request header and is
+// stored in the context, so ClientTransport forwards it on outbound
+// calls. A missing or malformed header counts as zero hops. A maxHops
+// of zero or less disables the limit; hops are still counted and
+// forwarded.
+func HopLimitMiddleware(maxHops int) func(http.Handler) http.Handler {
+	return defaultEnvelope().HopLimitMiddleware(maxHops)
+}
+
+// HopLimitMiddleware is like the package-level HopLimitMiddleware, writing with env.
+func (env *Envelope) HopLimitMiddleware(maxHops int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hops, err := strconv.Atoi(r.Header.Get(HeaderRequestHops))
+			if err != nil || hops < 0 {
+				hops = 0
+			}
+			hops++
+			if maxHops > 0 && hops > maxHops {
+				env.Write(w, r, Internal("request loop detected").WithDetails(map[string]any{
+					"hops":     hops,
+					"max_hops": maxHops,
+				}))
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), hopsKey, hops))
+			r.Header.Set(HeaderRequestHops, strconv.Itoa(hops))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func hopsFromContext(ctx context.Context) (int, bool) {
+	n, ok := ctx.Value(hopsKey).(int)
+	return n, ok
+}
+
+// statusWriter records whether the response has been started.
+type statusWriter struct {
+	http.ResponseWriter
+	wrote bool
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if !isInformational(status) {
+		sw.wrote = true
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	sw.wrote = true
+	return sw.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer if it supports flushing.
+func (sw *statusWriter) Flush() {
+	sw.wrote = true
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (sw *statusWriter) Unwrap() http.ResponseWriter { return sw.ResponseWriter }
+
 func newTraceID() string {
 	var b [16]byte
 	_, _ = rand.Read(b[:])
 	return hex.EncodeToString(b[:])
 }
+
+// EnvelopeResponseMiddleware converts error responses written without
+// err-envelope (http.Error, bare w.WriteHeader(500), etc.) into envelopes.
+//
+// Responses with a status below 400 pass through untouched and unbuffered.
+// For error statuses the body is buffered until the handler returns; if it
+// is already an envelope (or problem document) it is sent as-is, otherwise
+// it is replaced with an envelope whose code is derived from the status.
+// Plain-text bodies of 4xx responses become the envelope message; 5xx
+// bodies are dropped in favor of the default message to avoid leaking
+// internals.
+func EnvelopeResponseMiddleware(next http.Handler) http.Handler {
+	return defaultEnvelope().EnvelopeResponseMiddleware(next)
+}
+
+// EnvelopeResponseMiddleware is like the package-level
+// EnvelopeResponseMiddleware, writing with env.
+func (env *Envelope) EnvelopeResponseMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ew := &envelopeWriter{ResponseWriter: w, env: env}
+		next.ServeHTTP(ew, r)
+		ew.finish(r)
+	})
+}
+
+// envelopeWriter buffers error responses so they can be rewritten.
+type envelopeWriter struct {
+	http.ResponseWriter
+	env       *Envelope
+	status    int
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (ew *envelopeWriter) WriteHeader(status int) {
+	if ew.status != 0 {
+		return
+	}
+	if isInformational(status) {
+		// 1xx responses (e.g. 103 Early Hints) precede the final status
+		ew.ResponseWriter.WriteHeader(status)
+		return
+	}
+	ew.status = status
+	if status >= 400 {
+		ew.buffering = true
+		return
+	}
+	ew.ResponseWriter.WriteHeader(status)
+}
+
+func (ew *envelopeWriter) Write(b []byte) (int, error) {
+	if ew.status == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+	if ew.buffering {
+		return ew.body.Write(b)
+	}
+	return ew.ResponseWriter.Write(b)
+}
+
+// Flush forwards to the underlying writer for pass-through responses.
+// Buffered error responses are flushed when the handler returns.
+func (ew *envelopeWriter) Flush() {
+	if ew.buffering {
+		return
+	}
+	if f, ok := ew.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (ew *envelopeWriter) Unwrap() http.ResponseWriter { return ew.ResponseWriter }
+
+func (ew *envelopeWriter) finish(r *http.Request) {
+	if !ew.buffering {
+		return
+	}
+
+	if isEnvelopeBody(ew.Header().Get("Content-Type"), ew.body.Bytes()) {
+		ew.ResponseWriter.WriteHeader(ew.status)
+		_, _ = ew.ResponseWriter.Write(ew.body.Bytes())
+		return
+	}
+
+	msg := ""
+	if ew.status < 500 && strings.HasPrefix(ew.Header().Get("Content-Type"), "text/plain") {
+		msg = strings.TrimSpace(ew.body.String())
+	}
+	ew.Header().Del("Content-Length")
+	ew.env.Write(ew.ResponseWriter, r, New(CodeForStatus(ew.status), ew.status, msg))
+}
+
+// isInformational reports whether status is a 1xx response other than
+// 101 Switching Protocols, which net/http treats as final.
+func isInformational(status int) bool {
+	return status >= 100 && status < 200 && status != http.StatusSwitchingProtocols
+}
+
+// isEnvelopeBody reports whether body is already an err-envelope response
+// (a single envelope, an AlwaysArray list, or a problem document).
+func isEnvelopeBody(contentType string, body []byte) bool {
+	if !strings.Contains(contentType, "json") {
+		return false
+	}
+	var probe struct {
+		Code   *string           `json:"code"`
+		Errors []json.RawMessage `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return false
+	}
+	return probe.Code != nil || probe.Errors != nil
+}
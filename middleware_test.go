@@ -1,9 +1,17 @@
 package errenvelope
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestTraceIDFromRequestHeader(t *testing.T) {
@@ -192,3 +200,600 @@ func TestTraceMiddlewareIntegration(t *testing.T) {
 		t.Errorf("expected trace ID length 32, got %d", len(traceID))
 	}
 }
+
+func TestEnvelopeResponseMiddlewareHTTPError(t *testing.T) {
+	handler := EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+
+	req := httptest.NewRequest("GET", "/test", nil)
+	req.Header.Set(HeaderTraceID, "trace-mw")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expected status %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected Content-Type application/json, got %s", ct)
+	}
+
+	var response Error
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected envelope body, got %q: %v", w.Body.String(), err)
+	}
+	if response.Code != CodeInternal {
+		t.Errorf("expected code %s, got %s", CodeInternal, response.Code)
+	}
+	if response.Message != "Internal error" {
+		t.Errorf("expected default message for 5xx, got %q", response.Message)
+	}
+	if response.TraceID != "trace-mw" {
+		t.Errorf("expected trace ID trace-mw, got %s", response.TraceID)
+	}
+}
+
+func TestEnvelopeResponseMiddlewareClientErrorText(t *testing.T) {
+	handler := EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid user id", http.StatusNotFound)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	var response Error
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected envelope body: %v", err)
+	}
+	if response.Code != CodeNotFound || response.Message != "invalid user id" {
+		t.Errorf("expected NOT_FOUND with handler text, got %s %q", response.Code, response.Message)
+	}
+}
+
+func TestEnvelopeResponseMiddlewareBareStatus(t *testing.T) {
+	handler := EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	var response Error
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected envelope body: %v", err)
+	}
+	if response.Code != CodeUnavailable || !response.Retryable {
+		t.Errorf("expected retryable UNAVAILABLE, got %+v", response)
+	}
+}
+
+func TestEnvelopeResponseMiddlewarePassThrough(t *testing.T) {
+	handler := EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("created"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/test", nil))
+
+	if w.Code != http.StatusCreated || w.Body.String() != "created" {
+		t.Errorf("expected untouched 201 response, got %d %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+		t.Errorf("expected Content-Type text/plain, got %s", ct)
+	}
+}
+
+// statusLog records every status passed to WriteHeader.
+type statusLog struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (l *statusLog) WriteHeader(status int) {
+	l.statuses = append(l.statuses, status)
+	if status >= 200 {
+		l.ResponseRecorder.WriteHeader(status)
+	}
+}
+
+func TestEnvelopeResponseMiddlewareEarlyHints(t *testing.T) {
+	handler := EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Link", "</app.css>; rel=preload")
+		w.WriteHeader(http.StatusEarlyHints)
+		http.Error(w, "nope", http.StatusNotFound)
+	}))
+
+	w := &statusLog{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	if len(w.statuses) != 2 || w.statuses[0] != http.StatusEarlyHints || w.statuses[1] != http.StatusNotFound {
+		t.Errorf("expected 103 then 404, got %v", w.statuses)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || body["code"] != string(CodeNotFound) {
+		t.Errorf("expected a NOT_FOUND envelope, got %q", w.Body.String())
+	}
+}
+
+func TestEnvelopeResponseMiddlewareAlreadyEnveloped(t *testing.T) {
+	handler := EnvelopeResponseMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, Conflict("email already exists").WithDetails(map[string]any{"field": "email"}))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/test", nil))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+	}
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("expected envelope body: %v", err)
+	}
+	if response["message"] != "email already exists" || response["details"] == nil {
+		t.Errorf("expected original envelope to be preserved, got %v", response)
+	}
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := Chain(mw("a"), mw("b"), mw("c"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	if got := strings.Join(order, ","); got != "a,b,c,handler" {
+		t.Errorf("expected a,b,c,handler, got %s", got)
+	}
+}
+
+func TestChainPanicInTimedHandler(t *testing.T) {
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	handler := Chain(
+		TraceMiddleware,
+		RecoverMiddleware,
+		TimeoutMiddleware(time.Second),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("nil map write in handler")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d", w.Code)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected envelope body: %v", err)
+	}
+	if body["code"] != string(CodeInternal) {
+		t.Errorf("expected code INTERNAL, got %v", body["code"])
+	}
+	if id, _ := body["trace_id"].(string); id == "" || id != w.Header().Get(HeaderTraceID) {
+		t.Errorf("expected trace_id matching header, got %q and %q", id, w.Header().Get(HeaderTraceID))
+	}
+	if strings.Contains(w.Body.String(), "nil map write") {
+		t.Errorf("panic value leaked to client: %s", w.Body.String())
+	}
+}
+
+func TestRecoverMiddlewarePanicWithEnvelope(t *testing.T) {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(NotFound("order 7 not found"))
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusNotFound || !strings.Contains(w.Body.String(), "order 7 not found") {
+		t.Errorf("expected the panicked envelope written, got %d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), "stack=") || !strings.Contains(logs.String(), "goroutine") {
+		t.Errorf("expected the stack logged, got %s", logs.String())
+	}
+
+	// A panic with a plain error stays private
+	handler = RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(errors.New("dsn=postgres://secret"))
+	}))
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "secret") {
+		t.Errorf("expected a private 500, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoverMiddlewareAfterEarlyHints(t *testing.T) {
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		panic("boom")
+	}))
+
+	w := &statusLog{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/test", nil))
+
+	if w.Code != http.StatusInternalServerError || !strings.Contains(w.Body.String(), "INTERNAL") {
+		t.Errorf("expected a 500 envelope after 103, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestRecoverMiddlewareAbortHandler(t *testing.T) {
+	handler := RecoverMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to propagate, got %v", v)
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := TimeoutMiddleware(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), string(CodeTimeout)) {
+		t.Errorf("expected TIMEOUT envelope, got %s", w.Body.String())
+	}
+}
+
+func TestTimeoutMiddlewareHandlerResponds(t *testing.T) {
+	handler := TimeoutMiddleware(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		Write(w, r, r.Context().Err())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected status 504, got %d", w.Code)
+	}
+	if strings.Count(w.Body.String(), `"code"`) > 1 {
+		t.Errorf("expected exactly one envelope, got %s", w.Body.String())
+	}
+}
+
+func TestTraceIDExtractor(t *testing.T) {
+	TraceIDExtractor = func(r *http.Request) string {
+		// Stand-in for a claim read from a parsed JWT
+		if r.Header.Get("Authorization") == "Bearer token-with-claim" {
+			return "claim-req-42"
+		}
+		return ""
+	}
+	t.Cleanup(func() { TraceIDExtractor = nil })
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer token-with-claim")
+	if id := TraceIDFromRequest(r); id != "claim-req-42" {
+		t.Errorf("expected claim-based ID, got %q", id)
+	}
+
+	// Header still wins
+	r.Header.Set(HeaderTraceID, "header-id")
+	if id := TraceIDFromRequest(r); id != "header-id" {
+		t.Errorf("expected header ID to take priority, got %q", id)
+	}
+
+	// TraceMiddleware uses the extractor instead of generating an ID
+	var seen string
+	handler := TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = TraceIDFromRequest(r)
+		Write(w, r, NotFound(""))
+	}))
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer token-with-claim")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if seen != "claim-req-42" || w.Header().Get(HeaderTraceID) != "claim-req-42" {
+		t.Errorf("expected middleware to use claim ID, got %q / %q", seen, w.Header().Get(HeaderTraceID))
+	}
+
+	// No claim: a new ID is generated
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(seen) != 32 {
+		t.Errorf("expected generated ID, got %q", seen)
+	}
+}
+
+func TestLatencyMiddleware(t *testing.T) {
+	slow := LatencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(30 * time.Millisecond)
+		Write(w, r, Unavailable("too slow"))
+	}))
+	w := httptest.NewRecorder()
+	slow.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	var body struct {
+		Details map[string]any `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	elapsed, ok := body.Details["elapsed_ms"].(float64)
+	if !ok || elapsed < 30 {
+		t.Errorf("expected elapsed_ms >= 30, got %v", body.Details["elapsed_ms"])
+	}
+
+	ok200 := LatencyMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	w = httptest.NewRecorder()
+	ok200.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Body.String() != "ok" {
+		t.Errorf("expected success untouched, got %q", w.Body.String())
+	}
+}
+
+// spanContextKey stands in for an OpenTelemetry span context.
+type spanContextKey struct{}
+
+type testSpanContext struct{ traceID, spanID string }
+
+func TestSpanIDExtractor(t *testing.T) {
+	fromSpan := func(r *http.Request) (testSpanContext, bool) {
+		sc, ok := r.Context().Value(spanContextKey{}).(testSpanContext)
+		return sc, ok
+	}
+	TraceIDExtractor = func(r *http.Request) string {
+		sc, _ := fromSpan(r)
+		return sc.traceID
+	}
+	SpanIDExtractor = func(r *http.Request) string {
+		sc, _ := fromSpan(r)
+		return sc.spanID
+	}
+	t.Cleanup(func() {
+		TraceIDExtractor = nil
+		SpanIDExtractor = nil
+	})
+
+	var logged bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&logged, nil))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, Unavailable(""))
+	})
+
+	sc := testSpanContext{traceID: "4bf92f3577b34da6a3ce929d0e0e4736", spanID: "00f067aa0ba902b7"}
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), spanContextKey{}, sc))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	e, err := ReadFrom(w.Body)
+	if err != nil {
+		t.Fatalf("failed to read envelope: %v", err)
+	}
+	if e.TraceID != sc.traceID || e.SpanID != sc.spanID {
+		t.Errorf("expected IDs from the span context, got %q %q", e.TraceID, e.SpanID)
+	}
+
+	logger.Error("request failed", "error", e)
+	if !strings.Contains(logged.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736","span_id":"00f067aa0ba902b7"`) {
+		t.Errorf("expected both IDs in logs, got %s", logged.String())
+	}
+
+	// An error's own span ID wins
+	w = httptest.NewRecorder()
+	Write(w, r, Unavailable("").WithSpanID("own-span"))
+	if e, _ := ReadFrom(w.Body); e.SpanID != "own-span" {
+		t.Errorf("expected the error's span ID kept, got %q", e.SpanID)
+	}
+}
+
+func TestHopLimitMiddleware(t *testing.T) {
+	var seen string
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(HeaderRequestHops)
+	}))
+	defer upstream.Close()
+	client := &http.Client{Transport: &ClientTransport{}}
+
+	handler := HopLimitMiddleware(3)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(HeaderRequestHops)
+		req, _ := http.NewRequestWithContext(r.Context(), "GET", upstream.URL, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// A normal request passes through with the count incremented
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(HeaderRequestHops, "1")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent || seen != "2" {
+		t.Errorf("expected pass-through with 2 hops, got %d and %q", w.Code, seen)
+	}
+	if forwarded != "2" {
+		t.Errorf("expected the client transport to forward 2 hops, got %q", forwarded)
+	}
+
+	// No header counts as the first hop
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusNoContent || seen != "1" {
+		t.Errorf("expected pass-through with 1 hop, got %d and %q", w.Code, seen)
+	}
+
+	// Exceeding the max short-circuits with the loop error
+	seen = ""
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(HeaderRequestHops, "3")
+	handler.ServeHTTP(w, r)
+	e, err := ReadFrom(w.Body)
+	if err != nil || w.Code != http.StatusInternalServerError || e.Code != CodeInternal {
+		t.Fatalf("expected INTERNAL envelope, got %d %+v (%v)", w.Code, e, err)
+	}
+	if e.Message != "request loop detected" || seen != "" {
+		t.Errorf("expected loop error without calling the handler, got %q (handler saw %q)", e.Message, seen)
+	}
+}
+
+func TestHopLimitMiddlewareDisabled(t *testing.T) {
+	for _, maxHops := range []int{0, -1} {
+		var seen string
+		handler := HopLimitMiddleware(maxHops)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = r.Header.Get(HeaderRequestHops)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(HeaderRequestHops, "40")
+		handler.ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent || seen != "41" {
+			t.Errorf("maxHops %d: expected pass-through with 41 hops, got %d and %q", maxHops, w.Code, seen)
+		}
+	}
+}
+
+func TestSkipTrace(t *testing.T) {
+	SkipTrace = func(r *http.Request) bool { return r.URL.Path == "/healthz" }
+	t.Cleanup(func() { SkipTrace = nil })
+
+	var seen string
+	handler := TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = TraceIDFromRequest(r)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/healthz", nil))
+	if seen != "" {
+		t.Errorf("expected no generated trace ID for a skipped path, got %q", seen)
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users", nil))
+	if seen == "" {
+		t.Error("expected a generated trace ID for other paths")
+	}
+
+	// An Envelope's own predicate applies to its middleware
+	env := &Envelope{SkipTrace: func(r *http.Request) bool { return r.URL.Path == "/metrics" }}
+	env.TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = env.TraceIDFromRequest(r)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+	if seen != "" {
+		t.Errorf("expected the envelope's predicate to skip, got %q", seen)
+	}
+}
+
+func TestTraceHeaderOrder(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("X-Request-Id", "req-1")
+	r.Header.Set("X-Correlation-Id", "corr-1")
+	r.Header.Set("traceparent", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+
+	TraceHeaderOrder = []string{"X-Correlation-Id", "X-Request-Id"}
+	t.Cleanup(func() { TraceHeaderOrder = nil })
+	if id := TraceIDFromRequest(r); id != "corr-1" {
+		t.Errorf("expected X-Correlation-Id to win, got %q", id)
+	}
+
+	TraceHeaderOrder = []string{"traceparent", "X-Correlation-Id", "X-Request-Id"}
+	if id := TraceIDFromRequest(r); id != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the traceparent trace-id to win, got %q", id)
+	}
+
+	// Missing or malformed headers fall through to the next one
+	r.Header.Set("traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	TraceHeaderOrder = []string{"X-B3-TraceId", "traceparent", "X-Request-Id"}
+	if id := TraceIDFromRequest(r); id != "req-1" {
+		t.Errorf("expected fallthrough to X-Request-Id, got %q", id)
+	}
+
+	// The response still uses the trace header
+	w := httptest.NewRecorder()
+	Write(w, r, NotFound(""))
+	if got := w.Header().Get(HeaderTraceID); got != "req-1" {
+		t.Errorf("expected response trace header req-1, got %q", got)
+	}
+
+	// Nil restores the single trace header
+	TraceHeaderOrder = nil
+	if id := TraceIDFromRequest(r); id != "req-1" {
+		t.Errorf("expected the default header, got %q", id)
+	}
+}
+
+func TestWithForcedTraceID(t *testing.T) {
+	TraceIDExtractor = func(r *http.Request) string { return "from-extractor" }
+	t.Cleanup(func() { TraceIDExtractor = nil })
+
+	handler := TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Write(w, r, Unavailable(""))
+	}))
+	serve := func(r *http.Request) *Error {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		e, err := ReadFrom(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := w.Header().Get(HeaderTraceID); got != e.TraceID {
+			t.Errorf("expected header %q to match body %q", got, e.TraceID)
+		}
+		return e
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	ctx := WithTraceID(r.Context(), "from-context")
+	r = r.WithContext(WithForcedTraceID(ctx, "trace-test"))
+	if e := serve(r); e.TraceID != "trace-test" {
+		t.Errorf("expected the forced ID, got %q", e.TraceID)
+	}
+	if e := FromContext(r.Context(), errors.New("x")); e.TraceID != "trace-test" {
+		t.Errorf("expected FromContext to use the forced ID, got %q", e.TraceID)
+	}
+
+	// An inbound header still wins
+	r.Header.Set(HeaderTraceID, "from-header")
+	if e := serve(r); e.TraceID != "from-header" {
+		t.Errorf("expected the inbound header to win, got %q", e.TraceID)
+	}
+
+	// Including for FromContext behind TraceMiddleware
+	var seen string
+	TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = FromContext(r.Context(), errors.New("x")).TraceID
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if seen != "from-header" {
+		t.Errorf("expected FromContext to see the header ID, got %q", seen)
+	}
+}
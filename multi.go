@@ -0,0 +1,93 @@
+package errenvelope
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Multi aggregates several errors into one envelope, e.g. the failures of
+// parallel subtasks. Each error is mapped with From and listed in
+// details under "errors". The aggregate takes the most severe (highest)
+// child status; its code is the children's code if they all share one,
+// and otherwise the code for that status. It is retryable only if every
+// child is. The children are joined as the cause, so errors.Is and
+// errors.As see them.
+//
+// Nil errors are skipped. Multi returns nil if nothing is left, and the
+// mapped error itself if only one is.
+func Multi(errs ...error) *Error {
+	children := make([]*Error, 0, len(errs))
+	causes := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if e := From(err); e != nil {
+			children = append(children, e)
+			causes = append(causes, err)
+		}
+	}
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	}
+
+	code, status, retryable := children[0].Code, children[0].Status, true
+	for _, c := range children {
+		if c.Status > status {
+			status = c.Status
+		}
+		if c.Code != code {
+			code = ""
+		}
+		retryable = retryable && c.Retryable
+	}
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+
+	return Wrap(code, status, fmt.Sprintf("%d errors occurred", len(children)), errors.Join(causes...)).
+		WithDetails(map[string]any{"errors": children}).
+		WithRetryable(retryable)
+}
+
+// Collector gathers errors from concurrent subtasks into one Multi
+// envelope, where errgroup would keep only the first. It is safe for use
+// by multiple goroutines; the zero value is ready to use.
+//
+//	var c errenvelope.Collector
+//	var wg sync.WaitGroup
+//	for _, id := range ids {
+//	    wg.Add(1)
+//	    go func() {
+//	        defer wg.Done()
+//	        c.Add(fetch(ctx, id))
+//	    }()
+//	}
+//	wg.Wait()
+//	if err := c.Err(); err != nil {
+//	    errenvelope.Write(w, r, err)
+//	}
+type Collector struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// Add records err. Nil errors are ignored.
+func (c *Collector) Add(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, err)
+}
+
+// Err returns the errors added so far as a Multi envelope, or nil if
+// there are none.
+func (c *Collector) Err() *Error {
+	c.mu.Lock()
+	errs := append([]error(nil), c.errs...)
+	c.mu.Unlock()
+	return Multi(errs...)
+}
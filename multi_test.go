@@ -0,0 +1,82 @@
+package errenvelope
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestMulti(t *testing.T) {
+	e := Multi(NotFound("user 1"), nil, Unavailable("billing down"))
+	if e.Status != http.StatusServiceUnavailable || e.Code != CodeUnavailable {
+		t.Errorf("expected the most severe status, got %d %s", e.Status, e.Code)
+	}
+	if e.Retryable {
+		t.Error("expected not retryable when any child isn't")
+	}
+	children := e.Details.(map[string]any)["errors"].([]*Error)
+	if len(children) != 2 || children[0].Code != CodeNotFound || children[1].Code != CodeUnavailable {
+		t.Errorf("unexpected children: %v", children)
+	}
+	if !errors.Is(e, ErrNotFound) || !errors.Is(e, ErrUnavailable) {
+		t.Error("expected errors.Is to see the children")
+	}
+
+	// Shared code is kept; mixed 4xx falls back to the status's code
+	if e := Multi(Conflict("a"), Conflict("b")); e.Code != CodeConflict || e.Message != "2 errors occurred" {
+		t.Errorf("expected shared code, got %s %q", e.Code, e.Message)
+	}
+	if e := Multi(NotFound(""), Gone("")); e.Code != CodeGone || e.Status != http.StatusGone {
+		t.Errorf("expected 410 GONE, got %d %s", e.Status, e.Code)
+	}
+	if e := Multi(RateLimited(""), Timeout("")); !e.Retryable {
+		t.Error("expected retryable when every child is")
+	}
+
+	if Multi() != nil || Multi(nil, nil) != nil {
+		t.Error("expected nil for no errors")
+	}
+	if one := NotFound("x"); Multi(one) != one {
+		t.Error("expected a single error to be returned as-is")
+	}
+}
+
+// Run with -race.
+func TestCollectorConcurrentAdd(t *testing.T) {
+	var c Collector
+	if c.Err() != nil {
+		t.Fatal("expected nil from an empty collector")
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c.Add(NotFound(fmt.Sprintf("item %d", i)))
+			c.Add(nil)
+		}(i)
+	}
+	wg.Wait()
+
+	e := c.Err()
+	children := e.Details.(map[string]any)["errors"].([]*Error)
+	if len(children) != workers {
+		t.Fatalf("expected %d children, got %d", workers, len(children))
+	}
+	seen := map[string]bool{}
+	for _, child := range children {
+		seen[child.Message] = true
+	}
+	for i := 0; i < workers; i++ {
+		if !seen[fmt.Sprintf("item %d", i)] {
+			t.Errorf("missing child for item %d", i)
+		}
+	}
+	if e.Code != CodeNotFound || e.Status != http.StatusNotFound {
+		t.Errorf("unexpected aggregate: %s %d", e.Code, e.Status)
+	}
+}
@@ -0,0 +1,79 @@
+package errenvelope
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// MultiStatusBody is the body of a bulk response mixing successes and
+// failures: {"results": [...], "errors": [...]}.
+type MultiStatusBody struct {
+	Results any      `json:"results"`
+	Errors  []*Error `json:"errors"`
+}
+
+// MultiStatus assembles the body of a bulk response and its status: 207
+// Multi-Status when any item failed, 200 when errs is empty. Unlike a
+// single aggregate error, successes and failures are reported side by
+// side. errs is never encoded as null.
+//
+// Example:
+//
+//	status, body := errenvelope.MultiStatus(created, failures)
+//	// encode body with your own writer, or use WriteMultiStatus
+func MultiStatus(results any, errs []*Error) (int, any) {
+	if errs == nil {
+		errs = []*Error{}
+	}
+	status := http.StatusOK
+	if len(errs) > 0 {
+		status = http.StatusMultiStatus
+	}
+	return status, MultiStatusBody{Results: results, Errors: errs}
+}
+
+// WriteMultiStatus writes a bulk response built by MultiStatus. Each
+// error is prepared like Write prepares one: it gets the request's trace
+// ID and span ID when unset, a help URL from DocsBaseURL, and context
+// details, and with OmitTraceIDInBody no error carries a trace ID. Headers
+// such as Retry-After stay per-error in the body. The caller's errors are
+// not mutated.
+func WriteMultiStatus(w http.ResponseWriter, r *http.Request, results any, errs []*Error) {
+	defaultEnvelope().WriteMultiStatus(w, r, results, errs)
+}
+
+// WriteMultiStatus is like the package-level WriteMultiStatus, using env's configuration.
+func (env *Envelope) WriteMultiStatus(w http.ResponseWriter, r *http.Request, results any, errs []*Error) {
+	acquired := make([]*Error, 0, len(errs))
+	defer func() {
+		for _, e := range acquired {
+			Release(e)
+		}
+	}()
+	stamped := make([]*Error, 0, len(errs))
+	for _, e := range errs {
+		if e == nil {
+			continue
+		}
+		p := env.acquire(e, r)
+		acquired = append(acquired, p)
+		stamped = append(stamped, env.bodyError(p))
+	}
+
+	status, body := MultiStatus(results, stamped)
+	b := getBodyBuffer()
+	defer releaseBodyBuffer(b)
+	if err := b.enc.Encode(body); err != nil {
+		env.reportWriteError(r, fmt.Errorf("errenvelope: marshal multi-status body: %w", err), false)
+		env.Write(w, r, Internal(""))
+		return
+	}
+
+	if traceID := env.TraceIDFromRequest(r); traceID != "" {
+		w.Header().Set(env.traceHeader(), traceID)
+	}
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	w.WriteHeader(status)
+
+	env.writeBody(w, r, b.Bytes())
+}
@@ -0,0 +1,120 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMultiStatus(t *testing.T) {
+	status, _ := MultiStatus([]string{"a", "b"}, nil)
+	if status != http.StatusOK {
+		t.Errorf("expected 200 without errors, got %d", status)
+	}
+
+	status, body := MultiStatus([]string{"a"}, []*Error{NotFound("missing b")})
+	if status != http.StatusMultiStatus {
+		t.Errorf("expected 207 with errors, got %d", status)
+	}
+	if b := body.(MultiStatusBody); len(b.Errors) != 1 || b.Errors[0].Code != CodeNotFound {
+		t.Errorf("unexpected body: %+v", b)
+	}
+}
+
+func TestWriteMultiStatus(t *testing.T) {
+	type result struct {
+		ID string `json:"id"`
+	}
+	failure := Conflict("duplicate")
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/bulk", nil)
+	r.Header.Set(HeaderTraceID, "trace-bulk")
+
+	WriteMultiStatus(w, r, []result{{ID: "1"}, {ID: "2"}}, []*Error{failure, nil})
+
+	if w.Code != http.StatusMultiStatus {
+		t.Errorf("expected 207, got %d", w.Code)
+	}
+	if got := w.Header().Get(HeaderTraceID); got != "trace-bulk" {
+		t.Errorf("expected trace header, got %q", got)
+	}
+
+	var body struct {
+		Results []result `json:"results"`
+		Errors  []*Error `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("invalid body: %v", err)
+	}
+	if len(body.Results) != 2 || body.Results[1].ID != "2" {
+		t.Errorf("expected both results, got %+v", body.Results)
+	}
+	if len(body.Errors) != 1 || body.Errors[0].Code != CodeConflict || body.Errors[0].TraceID != "trace-bulk" {
+		t.Errorf("expected one traced error, got %+v", body.Errors)
+	}
+	if failure.TraceID != "" {
+		t.Error("expected the caller's error to be left unchanged")
+	}
+
+	// All successes: 200 with an empty errors array, not null
+	w = httptest.NewRecorder()
+	WriteMultiStatus(w, httptest.NewRequest("POST", "/bulk", nil), []result{{ID: "1"}}, nil)
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(w.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || string(raw["errors"]) != "[]" {
+		t.Errorf("expected 200 with empty errors, got %d %s", w.Code, raw["errors"])
+	}
+}
+
+func TestWriteMultiStatusOmitTraceIDInBody(t *testing.T) {
+	env := &Envelope{OmitTraceIDInBody: true}
+	pre := NotFound("item 2").WithTraceID("trace-pre")
+	errs := []*Error{pre, Conflict("item 3")}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/bulk", nil)
+	r.Header.Set(HeaderTraceID, "trace-req")
+	env.WriteMultiStatus(w, r, []string{"item 1"}, errs)
+
+	if strings.Contains(w.Body.String(), "trace_id") {
+		t.Errorf("expected no trace_id in the body, got %s", w.Body.String())
+	}
+	if got := w.Header().Get(HeaderTraceID); got != "trace-req" {
+		t.Errorf("expected the trace header kept, got %q", got)
+	}
+	if pre.TraceID != "trace-pre" || errs[1].TraceID != "" {
+		t.Error("expected the caller's errors unchanged")
+	}
+}
+
+func TestWriteMultiStatusPreparesErrors(t *testing.T) {
+	env := &Envelope{
+		DocsBaseURL:     "https://docs.example.com/errors",
+		SpanIDExtractor: func(r *http.Request) string { return "span-1" },
+	}
+	errs := []*Error{NotFound("item 2")}
+
+	w := httptest.NewRecorder()
+	env.WriteMultiStatus(w, httptest.NewRequest("POST", "/bulk", nil), []string{"item 1"}, errs)
+
+	var body struct {
+		Errors []map[string]any `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Errors) != 1 {
+		t.Fatalf("expected one error, got %s", w.Body.String())
+	}
+	got := body.Errors[0]
+	if got["span_id"] != "span-1" {
+		t.Errorf("expected span_id span-1, got %v", got["span_id"])
+	}
+	if u, _ := got["help_url"].(string); !strings.HasPrefix(u, "https://docs.example.com/errors/") {
+		t.Errorf("expected help_url from DocsBaseURL, got %v", got["help_url"])
+	}
+	if errs[0].SpanID != "" || errs[0].HelpURL != "" {
+		t.Error("expected the caller's error unchanged")
+	}
+}
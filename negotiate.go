@@ -0,0 +1,88 @@
+package errenvelope
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mediaRange is a single entry from an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	q            float64
+}
+
+// negotiate picks the best of the offered media types for an Accept header.
+//
+// Media ranges are ranked by q-value; the most specific matching range
+// (type/subtype over type/* over */*) determines an offer's quality.
+// Parameters other than q (such as charset) are ignored.
+// Ties, a missing Accept header, or a bare */* resolve to the first offer,
+// so offers should be listed in order of server preference (JSON first).
+// Returns "" if none of the offers are acceptable.
+func negotiate(accept string, offered ...string) string {
+	if len(offered) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offered[0]
+	}
+
+	ranges := parseAccept(accept)
+	if len(ranges) == 0 {
+		return offered[0]
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offered {
+		if q := quality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// quality returns the q-value the client assigns to offer, using the
+// most specific matching media range.
+func quality(ranges []mediaRange, offer string) float64 {
+	typ, subtype, _ := strings.Cut(strings.ToLower(offer), "/")
+
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == "*" && mr.subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.q, s
+		}
+	}
+	return q
+}
+
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		typ, subtype, ok := strings.Cut(strings.ToLower(strings.TrimSpace(params[0])), "/")
+		if !ok || typ == "" || subtype == "" {
+			continue
+		}
+
+		mr := mediaRange{typ: typ, subtype: subtype, q: 1}
+		for _, p := range params[1:] {
+			k, v, _ := strings.Cut(strings.TrimSpace(p), "=")
+			if strings.EqualFold(strings.TrimSpace(k), "q") {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && q >= 0 && q <= 1 {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
@@ -0,0 +1,45 @@
+package errenvelope
+
+import "testing"
+
+func TestNegotiate(t *testing.T) {
+	offered := []string{ContentTypeJSON, ContentTypeProblem}
+
+	tests := []struct {
+		name   string
+		accept string
+		want   string
+	}{
+		{"empty", "", ContentTypeJSON},
+		{"wildcard", "*/*", ContentTypeJSON},
+		{"json", "application/json", ContentTypeJSON},
+		{"json with charset", "application/json;charset=utf-8", ContentTypeJSON},
+		{"problem", "application/problem+json", ContentTypeProblem},
+		{"application wildcard", "application/*", ContentTypeJSON},
+		{"tie prefers json", "application/problem+json, application/json", ContentTypeJSON},
+		{"q-values rank problem", "application/json;q=0.5, application/problem+json", ContentTypeProblem},
+		{"q-values rank json", "application/xml;q=0.9, application/json;q=1.0", ContentTypeJSON},
+		{"xml only tolerated wildcard", "application/xml, */*;q=0.1", ContentTypeJSON},
+		{"specific beats wildcard", "*/*;q=0.8, application/json;q=0.2", ContentTypeProblem},
+		{"case insensitive", "Application/JSON; Q=1", ContentTypeJSON},
+		{"spaces", " text/html ; q=0.9 , application/problem+json ; q=0.95 ", ContentTypeProblem},
+		{"unacceptable", "text/csv", ""},
+		{"explicitly refused", "text/csv;q=1, */*;q=0", ""},
+		{"malformed ignored", "garbage, application/problem+json", ContentTypeProblem},
+		{"all malformed", "garbage", ContentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := negotiate(tt.accept, offered...); got != tt.want {
+				t.Errorf("negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNegotiateNoOffers(t *testing.T) {
+	if got := negotiate("*/*"); got != "" {
+		t.Errorf("expected empty result with no offers, got %q", got)
+	}
+}
@@ -0,0 +1,92 @@
+package errenvelope
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// errorPool holds scratch envelopes for the Write path. Write copies the
+// caller's error into a pooled instance before stamping request-scoped
+// fields, so the caller's error is never mutated and no per-request clone
+// is allocated.
+var errorPool = sync.Pool{
+	New: func() any { return new(Error) },
+}
+
+// bodyPool holds encode buffers for response bodies, so Write doesn't
+// allocate a fresh byte slice per response.
+var bodyPool = sync.Pool{
+	New: func() any {
+		b := new(bodyBuffer)
+		b.enc = json.NewEncoder(&b.Buffer)
+		return b
+	},
+}
+
+// maxPooledBody caps the buffers kept in bodyPool, so one huge body
+// doesn't pin its memory for the life of the process.
+const maxPooledBody = 64 << 10
+
+// bodyBuffer is a pooled buffer with an encoder writing into it.
+type bodyBuffer struct {
+	bytes.Buffer
+	enc *json.Encoder
+}
+
+func getBodyBuffer() *bodyBuffer {
+	return bodyPool.Get().(*bodyBuffer)
+}
+
+func releaseBodyBuffer(b *bodyBuffer) {
+	if b.Cap() > maxPooledBody {
+		return
+	}
+	b.Reset()
+	bodyPool.Put(b)
+}
+
+// Release returns e to the internal pool used by Write.
+//
+// This is an optimization for hot handlers that construct a fresh error per
+// request: after Write returns, the handler may Release the error it built.
+// Only release errors you created and have not shared. A released error
+// must not be stored, returned, logged asynchronously, or used again in any
+// way, since it may be handed out to another request at any time.
+// Never release sentinel values (ErrNotFound, etc.) or package-level errors.
+func Release(e *Error) {
+	if e == nil {
+		return
+	}
+	*e = Error{}
+	errorPool.Put(e)
+}
+
+// acquire returns a pooled copy of e with the request trace and span IDs, help URL,
+// and context details (see ContextWithDetail) stamped, and Retryable
+// downgraded for non-idempotent methods when RetryableForMethod is set.
+// A RetryAt is resolved to a fixed RetryAfter once, so the Retry-After
+// header and the body agree. The caller must Release the copy once the
+// response is written.
+func (env *Envelope) acquire(e *Error, r *http.Request) *Error {
+	p := errorPool.Get().(*Error)
+	*p = *e
+	if p.TraceID == "" {
+		p.TraceID = env.TraceIDFromRequest(r)
+	}
+	if p.SpanID == "" && r != nil && env.SpanIDExtractor != nil {
+		p.SpanID = env.SpanIDExtractor(r)
+	}
+	p.HelpURL = env.helpURL(p)
+	p.Details = mergeContextDetails(p.Details, r)
+	if env.RetryableForMethod && p.Retryable && r != nil && !isIdempotentMethod(r.Method) && !isRetryableOnAnyMethod(p.Code) {
+		p.Retryable = false
+	}
+	if !p.RetryAt.IsZero() {
+		p.RetryAfter = p.retryDelay()
+		p.RetryAt = time.Time{}
+	}
+	return p
+}
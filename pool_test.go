@@ -0,0 +1,82 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRelease(t *testing.T) {
+	e := NotFound("gone").WithTraceID("trace-1").WithDetails(map[string]any{"id": 1})
+	Release(e)
+
+	if e.Code != "" || e.Message != "" || e.TraceID != "" || e.Details != nil || e.Status != 0 {
+		t.Errorf("expected released error to be reset, got %+v", e)
+	}
+
+	// Nil is a no-op
+	Release(nil)
+}
+
+func TestWriteDoesNotMutateCaller(t *testing.T) {
+	e := NotFound("user not found")
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/test", nil)
+		r.Header.Set(HeaderTraceID, "trace-pool")
+		Write(w, r, e)
+
+		var response Error
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if response.TraceID != "trace-pool" || response.Code != CodeNotFound {
+			t.Errorf("unexpected response: %+v", response)
+		}
+	}
+
+	if e.TraceID != "" {
+		t.Errorf("expected caller error to keep empty trace ID, got %s", e.TraceID)
+	}
+}
+
+// discardWriter is a ResponseWriter that drops the body, so benchmarks
+// measure Write itself rather than the recorder.
+type discardWriter struct{ h http.Header }
+
+func (d *discardWriter) Header() http.Header         { return d.h }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
+
+// BenchmarkWrite measures the pooled Write path.
+func BenchmarkWrite(b *testing.B) {
+	w := &discardWriter{h: http.Header{}}
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set(HeaderTraceID, "trace-bench")
+	e := NotFound("user not found")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		Write(w, r, e)
+	}
+}
+
+// BenchmarkWriteCloned measures the equivalent path that clones the error
+// with WithTraceID instead of using the pool, for comparison.
+func BenchmarkWriteCloned(b *testing.B) {
+	w := &discardWriter{h: http.Header{}}
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set(HeaderTraceID, "trace-bench")
+	e := NotFound("user not found")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		c := From(e).WithTraceID(TraceIDFromRequest(r))
+		status := defaultEnvelope().prepare(w, c)
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(c)
+	}
+}
@@ -0,0 +1,164 @@
+package errenvelope
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Problem is an RFC 7807 (RFC 9457) problem details document.
+// Envelope fields beyond the standard members are carried as extensions,
+// so clients can still read the stable code and retry signals.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+
+	// Extension members
+	Code       Code   `json:"code"`
+	Subcode    string `json:"subcode,omitempty"`
+	Hint       string `json:"hint,omitempty"`
+	HelpURL    string `json:"help_url,omitempty"`
+	Details    any    `json:"details,omitempty"`
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	ErrorID    string `json:"error_id,omitempty"`
+	Retryable  bool   `json:"retryable"`
+	Transient  bool   `json:"transient,omitempty"`
+	RetryAfter string `json:"retry_after,omitempty"`
+	ServerID   string `json:"server_id,omitempty"`
+
+	// InvalidParams lists validation field errors in the common
+	// "invalid-params" extension, sorted by name.
+	InvalidParams []InvalidParam `json:"invalid-params,omitempty"`
+}
+
+// InvalidParam is one entry of a problem's "invalid-params" extension.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// ToProblem converts an envelope into an RFC 7807 problem document.
+// The type is "about:blank", so the title is the HTTP status text.
+// Validation field errors (see ValidationMessages) are also listed as
+// "invalid-params" entries of {name, reason}, one per message, next to
+// the usual details.
+func ToProblem(e *Error) *Problem {
+	if e == nil {
+		return nil
+	}
+	status := e.EffectiveStatus()
+	p := &Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    e.Message,
+		Code:      e.Code,
+		Subcode:   e.Subcode,
+		Hint:      e.Hint,
+		HelpURL:   e.HelpURL,
+		Details:   normalizeDetails(e.Details),
+		TraceID:   e.TraceID,
+		SpanID:    e.SpanID,
+		ErrorID:   e.ErrorID,
+		Retryable: e.Retryable,
+		Transient: e.Transient,
+	}
+	if d := e.retryDelay(); d > 0 {
+		p.RetryAfter = d.String()
+	}
+	if ExposeServerID {
+		p.ServerID = ServerID
+	}
+	if msgs, ok := ValidationMessages(e); ok && len(msgs) > 0 {
+		p.InvalidParams = make([]InvalidParam, 0, len(msgs))
+		for name, reasons := range msgs {
+			for _, reason := range reasons {
+				p.InvalidParams = append(p.InvalidParams, InvalidParam{Name: name, Reason: reason})
+			}
+		}
+		sort.SliceStable(p.InvalidParams, func(i, j int) bool {
+			return p.InvalidParams[i].Name < p.InvalidParams[j].Name
+		})
+	}
+	return p
+}
+
+// WriteProblem writes the error as an application/problem+json document,
+// regardless of the request's Accept header. Headers (trace ID, Retry-After)
+// and status match Write. The request path is used as the problem instance.
+// With DocsBaseURL set, the problem type is the code's documentation URL
+// (see DocsSlug) instead of "about:blank". Options work as in Write.
+func WriteProblem(w http.ResponseWriter, r *http.Request, err error, opts ...WriteOption) {
+	defaultEnvelope().WriteProblem(w, r, err, opts...)
+}
+
+// WriteProblem is like the package-level WriteProblem, using env's configuration.
+func (env *Envelope) WriteProblem(w http.ResponseWriter, r *http.Request, err error, opts ...WriteOption) {
+	e := env.From(err)
+	if e == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	e = env.acquire(e, r)
+	defer Release(e)
+	for _, opt := range opts {
+		opt(e)
+	}
+	env.writeProblem(w, r, e)
+}
+
+// TrustForwardedHeaders makes the problem instance the original client
+// URL, rebuilt from the X-Forwarded-Host and X-Forwarded-Proto headers set
+// by a reverse proxy, e.g. "https://api.example.com/users/42" instead of
+// "/users/42". Enable it only behind a proxy that sets or strips these
+// headers: otherwise clients can spoof them. Off by default. Set once at
+// startup.
+var TrustForwardedHeaders bool
+
+// instance returns the problem instance for r: its escaped path, made
+// absolute from X-Forwarded-* headers when env trusts them. The query
+// string is left out, like the "path" detail NewForRequest records, since
+// it can carry tokens.
+func (env *Envelope) instance(r *http.Request) string {
+	if r == nil || r.URL == nil {
+		return ""
+	}
+	uri := r.URL.EscapedPath()
+	if !env.TrustForwardedHeaders {
+		return uri
+	}
+	host := firstForwarded(r.Header.Get("X-Forwarded-Host"))
+	if host == "" {
+		return uri
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if p := strings.ToLower(firstForwarded(r.Header.Get("X-Forwarded-Proto"))); p == "http" || p == "https" {
+		scheme = p
+	}
+	return scheme + "://" + host + uri
+}
+
+// firstForwarded returns the first, client-most value of a
+// comma-separated X-Forwarded-* header.
+func firstForwarded(v string) string {
+	v, _, _ = strings.Cut(v, ",")
+	return strings.TrimSpace(v)
+}
+
+func (env *Envelope) writeProblem(w http.ResponseWriter, r *http.Request, e *Error) {
+	body := env.marshalBody(r, e, shapeProblem)
+	defer releaseBodyBuffer(body)
+	status := env.prepare(w, e)
+
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.WriteHeader(status)
+
+	env.writeBody(w, r, body.Bytes())
+}
@@ -0,0 +1,288 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToProblem(t *testing.T) {
+	e := RateLimited("slow down").
+		WithTraceID("trace-1").
+		WithRetryAfter(30 * time.Second)
+
+	p := ToProblem(e)
+	if p.Type != "about:blank" {
+		t.Errorf("expected type about:blank, got %s", p.Type)
+	}
+	if p.Title != "Too Many Requests" {
+		t.Errorf("expected title 'Too Many Requests', got %s", p.Title)
+	}
+	if p.Status != http.StatusTooManyRequests {
+		t.Errorf("expected status %d, got %d", http.StatusTooManyRequests, p.Status)
+	}
+	if p.Detail != "slow down" {
+		t.Errorf("expected detail 'slow down', got %s", p.Detail)
+	}
+	if p.Code != CodeRateLimited || p.TraceID != "trace-1" || !p.Retryable || p.RetryAfter != "30s" {
+		t.Errorf("unexpected extension members: %+v", p)
+	}
+
+	if ToProblem(nil) != nil {
+		t.Error("expected nil problem for nil error")
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/users/42?expand=true", nil)
+	r.Header.Set(HeaderTraceID, "trace-abc")
+
+	WriteProblem(w, r, NotFound("user not found"))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeProblem {
+		t.Errorf("expected Content-Type %s, got %s", ContentTypeProblem, ct)
+	}
+	if id := w.Header().Get(HeaderTraceID); id != "trace-abc" {
+		t.Errorf("expected trace header trace-abc, got %s", id)
+	}
+
+	var p map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("failed to unmarshal problem: %v", err)
+	}
+	if p["title"] != "Not Found" || p["detail"] != "user not found" || p["status"] != float64(404) {
+		t.Errorf("unexpected standard members: %v", p)
+	}
+	if p["instance"] != "/users/42" {
+		t.Errorf("expected instance from request path, got %v", p["instance"])
+	}
+	if p["code"] != "NOT_FOUND" || p["trace_id"] != "trace-abc" {
+		t.Errorf("unexpected extension members: %v", p)
+	}
+}
+
+// negotiateProblem turns on NegotiateProblem for the test.
+func negotiateProblem(t *testing.T) {
+	t.Helper()
+	NegotiateProblem = true
+	t.Cleanup(func() { NegotiateProblem = false })
+}
+
+func TestWriteNegotiatesProblem(t *testing.T) {
+	negotiateProblem(t)
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", ContentTypeJSON},
+		{"*/*", ContentTypeJSON},
+		{"application/json", ContentTypeJSON},
+		{"application/problem+json", ContentTypeProblem},
+		{"application/json;q=0.5, application/problem+json;q=0.9", ContentTypeProblem},
+		{"application/xml;q=0.9, application/json;q=1.0", ContentTypeJSON},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/test", nil)
+			if tt.accept != "" {
+				r.Header.Set("Accept", tt.accept)
+			}
+
+			Write(w, r, Conflict("duplicate"))
+
+			if ct := w.Header().Get("Content-Type"); ct != tt.want {
+				t.Errorf("expected Content-Type %s, got %s", tt.want, ct)
+			}
+			if w.Code != http.StatusConflict {
+				t.Errorf("expected status %d, got %d", http.StatusConflict, w.Code)
+			}
+		})
+	}
+}
+
+func TestWriteIgnoresProblemAcceptByDefault(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set("Accept", ContentTypeProblem)
+
+	Write(w, r, Conflict("duplicate"))
+
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+		t.Errorf("expected the envelope without NegotiateProblem, got %s", ct)
+	}
+	var response map[string]any
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response["code"] != "CONFLICT" {
+		t.Errorf("expected a CONFLICT envelope, got %s", w.Body.String())
+	}
+
+	// An Envelope opts in on its own
+	w = httptest.NewRecorder()
+	(&Envelope{NegotiateProblem: true}).Write(w, r, Conflict("duplicate"))
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeProblem {
+		t.Errorf("expected problem+json with NegotiateProblem, got %s", ct)
+	}
+}
+
+func TestWriteStrictAccept(t *testing.T) {
+	t.Run("permissive default", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/report", nil)
+		r.Header.Set("Accept", "text/csv;q=1, */*;q=0")
+
+		Write(w, r, NotFound("report not found"))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+			t.Errorf("expected Content-Type %s, got %s", ContentTypeJSON, ct)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		StrictAccept = true
+		t.Cleanup(func() { StrictAccept = false })
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/report", nil)
+		r.Header.Set("Accept", "text/csv;q=1, */*;q=0")
+		r.Header.Set(HeaderTraceID, "trace-406")
+
+		Write(w, r, NotFound("report not found"))
+
+		if w.Code != http.StatusNotAcceptable {
+			t.Errorf("expected status %d, got %d", http.StatusNotAcceptable, w.Code)
+		}
+
+		var response map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatalf("failed to unmarshal response: %v", err)
+		}
+		if response["code"] != "NOT_ACCEPTABLE" {
+			t.Errorf("expected code NOT_ACCEPTABLE, got %v", response["code"])
+		}
+		if response["trace_id"] != "trace-406" {
+			t.Errorf("expected trace_id trace-406, got %v", response["trace_id"])
+		}
+		details, _ := response["details"].(map[string]any)
+		if supported, _ := details["supported"].([]any); len(supported) != 1 || supported[0] != ContentTypeJSON {
+			t.Errorf("expected supported media types in details, got %v", details)
+		}
+	})
+
+	t.Run("strict but acceptable", func(t *testing.T) {
+		StrictAccept = true
+		t.Cleanup(func() { StrictAccept = false })
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/report", nil)
+		r.Header.Set("Accept", "text/csv, application/json;q=0.1")
+
+		Write(w, r, NotFound("report not found"))
+
+		if w.Code != http.StatusNotFound {
+			t.Errorf("expected status %d, got %d", http.StatusNotFound, w.Code)
+		}
+	})
+}
+
+func TestWriteProblemInvalidParams(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteProblem(w, httptest.NewRequest("POST", "/users", nil), Validation(FieldErrors{
+		"name":  "required",
+		"email": "invalid format",
+	}))
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("failed to unmarshal problem: %v", err)
+	}
+	want := []InvalidParam{{Name: "email", Reason: "invalid format"}, {Name: "name", Reason: "required"}}
+	if len(p.InvalidParams) != len(want) {
+		t.Fatalf("expected %d invalid-params, got %+v", len(want), p.InvalidParams)
+	}
+	for i := range want {
+		if p.InvalidParams[i] != want[i] {
+			t.Errorf("invalid-params[%d]: expected %+v, got %+v", i, want[i], p.InvalidParams[i])
+		}
+	}
+	if p.Code != CodeValidationFailed || p.Status != http.StatusBadRequest {
+		t.Errorf("unexpected problem: %+v", p)
+	}
+
+	// Non-validation errors carry no invalid-params
+	if p := ToProblem(NotFound("")); p.InvalidParams != nil {
+		t.Errorf("expected no invalid-params, got %+v", p.InvalidParams)
+	}
+}
+
+func TestWriteProblemForwardedInstance(t *testing.T) {
+	instance := func(env *Envelope) any {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/users/42?expand=true", nil)
+		r.Header.Set("X-Forwarded-Host", "api.example.com, proxy.internal")
+		r.Header.Set("X-Forwarded-Proto", "https")
+		env.WriteProblem(w, r, NotFound(""))
+		var p map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to unmarshal problem: %v", err)
+		}
+		return p["instance"]
+	}
+
+	if got := instance(&Envelope{}); got != "/users/42" {
+		t.Errorf("expected forwarded headers ignored by default, got %v", got)
+	}
+	if got := instance(&Envelope{TrustForwardedHeaders: true}); got != "https://api.example.com/users/42" {
+		t.Errorf("expected the forwarded URL, got %v", got)
+	}
+
+	// The package-level flag, and no forwarded host to rebuild from
+	TrustForwardedHeaders = true
+	t.Cleanup(func() { TrustForwardedHeaders = false })
+	w := httptest.NewRecorder()
+	WriteProblem(w, httptest.NewRequest("GET", "/users/42", nil), NotFound(""))
+	if !strings.Contains(w.Body.String(), `"instance":"/users/42"`) {
+		t.Errorf("expected the request URI without forwarded headers, got %s", w.Body.String())
+	}
+}
+
+func TestWriteProblemTypeURL(t *testing.T) {
+	problemType := func() any {
+		w := httptest.NewRecorder()
+		WriteProblem(w, httptest.NewRequest("GET", "/users/42", nil), NotFound(""))
+		var p map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to unmarshal problem: %v", err)
+		}
+		return p["type"]
+	}
+
+	if got := problemType(); got != "about:blank" {
+		t.Errorf("expected about:blank without DocsBaseURL, got %v", got)
+	}
+
+	DocsBaseURL = "https://docs.example.com/errors/"
+	t.Cleanup(func() { DocsBaseURL = "" })
+	if got := problemType(); got != "https://docs.example.com/errors/not-found" {
+		t.Errorf("expected the docs URL as type, got %v", got)
+	}
+
+	DocsSlug = func(c Code) string { return strings.ToLower(string(c)) + ".html" }
+	t.Cleanup(func() { DocsSlug = nil })
+	if got := problemType(); got != "https://docs.example.com/errors/not_found.html" {
+		t.Errorf("expected the custom slug, got %v", got)
+	}
+	if got := defaultEnvelope().helpURL(NotFound("")); got != "https://docs.example.com/errors/not_found.html" {
+		t.Errorf("expected help_url to use the same slug, got %q", got)
+	}
+}
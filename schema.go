@@ -0,0 +1,59 @@
+package errenvelope
+
+import (
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+//go:embed schema.json
+var schemaJSON []byte
+
+// CodeDoc describes one code in the SchemaHandler document.
+type CodeDoc struct {
+	Code      Code     `json:"code"`
+	Status    int      `json:"status"`
+	Message   string   `json:"message"`
+	Retryable bool     `json:"retryable"`
+	Category  Category `json:"category"`
+}
+
+// SchemaHandler serves the error contract as JSON: the envelope's JSON
+// Schema and every known code (built-ins followed by codes added with
+// RegisterCode) with its status, default message, retryability, and category.
+// Mount it for client and SDK generators to fetch at runtime:
+//
+//	mux.Handle("GET /errors/schema", errenvelope.SchemaHandler())
+func SchemaHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc := struct {
+			Schema json.RawMessage `json:"schema"`
+			Codes  []CodeDoc       `json:"codes"`
+		}{
+			Schema: schemaJSON,
+			Codes:  codeDocs(),
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		_ = json.NewEncoder(w).Encode(doc)
+	})
+}
+
+// codeDocs lists built-in codes in declaration order, then registered
+// codes sorted by name.
+func codeDocs() []CodeDoc {
+	registered := registeredCodeList()
+	sort.Slice(registered, func(i, j int) bool { return registered[i] < registered[j] })
+
+	docs := make([]CodeDoc, 0, len(builtinCodes)+len(registered))
+	for _, c := range append(append([]Code{}, builtinCodes...), registered...) {
+		docs = append(docs, CodeDoc{
+			Code:      c,
+			Status:    StatusForCode(c),
+			Message:   defaultMessage(c),
+			Retryable: isRetryableDefault(c),
+			Category:  c.Category(),
+		})
+	}
+	return docs
+}
@@ -0,0 +1,88 @@
+package errenvelope
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func registerTestCode(t *testing.T, code Code, info CodeInfo) {
+	t.Helper()
+	RegisterCode(code, info)
+	t.Cleanup(func() {
+		codesMu.Lock()
+		defer codesMu.Unlock()
+		delete(registeredCodes, code)
+	})
+}
+
+func TestRegisterCode(t *testing.T) {
+	const code Code = "QUOTA_EXCEEDED"
+	registerTestCode(t, code, CodeInfo{Status: http.StatusPaymentRequired, Message: "Quota exceeded", Retryable: true})
+
+	e := New(code, code.HTTPStatus(), "")
+	if e.Status != http.StatusPaymentRequired {
+		t.Errorf("expected status 402, got %d", e.Status)
+	}
+	if e.Message != "Quota exceeded" {
+		t.Errorf("expected registered default message, got %s", e.Message)
+	}
+	if !e.Retryable {
+		t.Error("expected registered retryable default")
+	}
+}
+
+func TestRegisterCodePanics(t *testing.T) {
+	registerTestCode(t, "ALREADY_THERE", CodeInfo{Status: http.StatusConflict})
+
+	for _, code := range []Code{"", CodeNotFound, "ALREADY_THERE"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected panic registering %q", code)
+				}
+			}()
+			RegisterCode(code, CodeInfo{})
+		}()
+	}
+}
+
+func TestSchemaHandler(t *testing.T) {
+	registerTestCode(t, "QUOTA_EXCEEDED", CodeInfo{Status: http.StatusPaymentRequired, Message: "Quota exceeded"})
+
+	w := httptest.NewRecorder()
+	SchemaHandler().ServeHTTP(w, httptest.NewRequest("GET", "/errors/schema", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentTypeJSON {
+		t.Errorf("expected Content-Type %s, got %s", ContentTypeJSON, ct)
+	}
+
+	var doc struct {
+		Schema map[string]any `json:"schema"`
+		Codes  []CodeDoc      `json:"codes"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.Schema["title"] != "errenvelope.Error" {
+		t.Errorf("expected embedded schema, got %v", doc.Schema["title"])
+	}
+
+	byCode := map[Code]CodeDoc{}
+	for _, c := range doc.Codes {
+		byCode[c.Code] = c
+	}
+	if c, ok := byCode[CodeNotFound]; !ok || c.Status != http.StatusNotFound {
+		t.Errorf("expected NOT_FOUND with status 404, got %+v", c)
+	}
+	if c, ok := byCode["QUOTA_EXCEEDED"]; !ok || c.Status != http.StatusPaymentRequired || c.Message != "Quota exceeded" {
+		t.Errorf("expected registered QUOTA_EXCEEDED, got %+v", c)
+	}
+	if len(doc.Codes) != len(builtinCodes)+1 {
+		t.Errorf("expected %d codes, got %d", len(builtinCodes)+1, len(doc.Codes))
+	}
+}
@@ -0,0 +1,45 @@
+package errenvelope
+
+// Sentinel errors for comparison with errors.Is.
+//
+// Matching is by code, so errors.Is(NotFound("user 42"), ErrNotFound)
+// is true regardless of message, status overrides, or details:
+//
+//	if errors.Is(err, errenvelope.ErrNotFound) {
+//	    // ...
+//	}
+//
+// Sentinels carry the default message and status for their code, captured
+// at package initialization (so ErrCanceled keeps 499 even if
+// CanceledStatus is changed later). They can be written directly, and the
+// With* methods return copies, so deriving from a sentinel never mutates it.
+// Sentinels have no ErrorID, since they are shared rather than occurrences.
+var (
+	ErrInternal            = sentinel(CodeInternal)
+	ErrBadRequest          = sentinel(CodeBadRequest)
+	ErrValidationFailed    = sentinel(CodeValidationFailed)
+	ErrUnauthorized        = sentinel(CodeUnauthorized)
+	ErrForbidden           = sentinel(CodeForbidden)
+	ErrNotFound            = sentinel(CodeNotFound)
+	ErrMethodNotAllowed    = sentinel(CodeMethodNotAllowed)
+	ErrNotAcceptable       = sentinel(CodeNotAcceptable)
+	ErrRequestTimeout      = sentinel(CodeRequestTimeout)
+	ErrConflict            = sentinel(CodeConflict)
+	ErrGone                = sentinel(CodeGone)
+	ErrLengthRequired      = sentinel(CodeLengthRequired)
+	ErrPayloadTooLarge     = sentinel(CodePayloadTooLarge)
+	ErrUnprocessableEntity = sentinel(CodeUnprocessableEntity)
+	ErrRateLimited         = sentinel(CodeRateLimited)
+	ErrTimeout             = sentinel(CodeTimeout)
+	ErrCanceled            = sentinel(CodeCanceled)
+	ErrUnavailable         = sentinel(CodeUnavailable)
+	ErrDownstream          = sentinel(CodeDownstream)
+	ErrDownstreamTimeout   = sentinel(CodeDownstreamTimeout)
+)
+
+// sentinel builds a shared error value without an ErrorID.
+func sentinel(code Code) *Error {
+	e := New(code, StatusForCode(code), "")
+	e.ErrorID = ""
+	return e
+}
@@ -0,0 +1,60 @@
+package errenvelope
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSentinelIs(t *testing.T) {
+	if !errors.Is(NotFound("x"), ErrNotFound) {
+		t.Error("expected NotFound to match ErrNotFound")
+	}
+	if errors.Is(NotFound("x"), ErrConflict) {
+		t.Error("expected NotFound not to match ErrConflict")
+	}
+	if !errors.Is(NotFound("x").WithStatus(http.StatusGone).WithDetails("d"), ErrNotFound) {
+		t.Error("expected match regardless of status and details")
+	}
+
+	// Wrapped in a standard error chain
+	wrapped := fmt.Errorf("loading user: %w", Unauthorized("expired token"))
+	if !errors.Is(wrapped, ErrUnauthorized) {
+		t.Error("expected wrapped Unauthorized to match ErrUnauthorized")
+	}
+
+	// Non-envelope errors never match
+	if errors.Is(errors.New("not found"), ErrNotFound) {
+		t.Error("expected plain error not to match")
+	}
+}
+
+func TestSentinelDefaults(t *testing.T) {
+	if ErrNotFound.Status != http.StatusNotFound {
+		t.Errorf("expected status %d, got %d", http.StatusNotFound, ErrNotFound.Status)
+	}
+	if ErrNotFound.Message != "Not found" {
+		t.Errorf("expected default message, got %s", ErrNotFound.Message)
+	}
+	if !ErrRateLimited.Retryable {
+		t.Error("expected ErrRateLimited to be retryable")
+	}
+}
+
+func TestSentinelImmutable(t *testing.T) {
+	_ = ErrNotFound.WithTraceID("trace-1").WithDetails("details")
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/test", nil)
+	r.Header.Set(HeaderTraceID, "trace-2")
+	Write(w, r, ErrNotFound)
+
+	if ErrNotFound.TraceID != "" || ErrNotFound.Details != nil {
+		t.Errorf("sentinel should not be mutated, got %+v", ErrNotFound)
+	}
+	if w.Header().Get(HeaderTraceID) != "trace-2" {
+		t.Error("expected trace ID on response")
+	}
+}
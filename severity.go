@@ -0,0 +1,113 @@
+package errenvelope
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+)
+
+// Severity ranks how urgently an error needs attention, for alerting and
+// log levels. It renders as its lowercase name in JSON and logs.
+type Severity int
+
+const (
+	// SeverityInfo is an expected outcome, such as a canceled request.
+	SeverityInfo Severity = iota
+	// SeverityWarning is a client-side problem (4xx).
+	SeverityWarning
+	// SeverityError is a server-side failure that may clear on its own,
+	// such as an unavailable dependency.
+	SeverityError
+	// SeverityCritical is an internal error, usually a bug.
+	SeverityCritical
+)
+
+var severityNames = [...]string{
+	SeverityInfo:     "info",
+	SeverityWarning:  "warning",
+	SeverityError:    "error",
+	SeverityCritical: "critical",
+}
+
+// String returns the severity's lowercase name, e.g. "critical".
+func (s Severity) String() string {
+	if s >= 0 && int(s) < len(severityNames) {
+		return severityNames[s]
+	}
+	return "severity(" + strconv.Itoa(int(s)) + ")"
+}
+
+// MarshalJSON encodes the severity as its name, e.g. "critical".
+func (s Severity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON decodes a severity name written by MarshalJSON.
+func (s *Severity) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for i, n := range severityNames {
+		if n == name {
+			*s = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("errenvelope: unknown severity %q", name)
+}
+
+// Severity returns the error's severity, derived from its code and
+// status: canceled requests are info, other 4xx warnings, INTERNAL
+// (and 500s with an unknown code) critical, and other 5xx errors.
+func (e *Error) Severity() Severity {
+	if e == nil {
+		return SeverityInfo
+	}
+	status := e.EffectiveStatus()
+	switch {
+	case e.Code == CodeCanceled:
+		return SeverityInfo
+	case status < 500:
+		return SeverityWarning
+	case e.Code == CodeInternal:
+		return SeverityCritical
+	case status == http.StatusInternalServerError && !isBuiltinCode(e.Code):
+		if _, registered := lookupCode(e.Code); !registered {
+			return SeverityCritical
+		}
+	}
+	return SeverityError
+}
+
+// Level returns the slog level for s: info, warn, or error (for both
+// SeverityError and SeverityCritical).
+func (s Severity) Level() slog.Level {
+	switch s {
+	case SeverityInfo:
+		return slog.LevelInfo
+	case SeverityWarning:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
+
+// Log maps err with FromContext, so the trace ID from ctx is attached, and
+// logs it to slog.Default() under the "error" key at the level of its
+// severity: error for 5xx, warn for 4xx, info for canceled requests. The
+// record message is the envelope message. A nil err logs nothing.
+//
+//	if err != nil {
+//	    errenvelope.Log(r.Context(), err)
+//	    errenvelope.Write(w, r, err)
+//	}
+func Log(ctx context.Context, err error) {
+	e := FromContext(ctx, err)
+	if e == nil {
+		return
+	}
+	slog.Default().Log(ctx, e.Severity().Level(), e.Message, "error", e)
+}
@@ -0,0 +1,111 @@
+package errenvelope
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestSeverityString(t *testing.T) {
+	tests := []struct {
+		sev  Severity
+		name string
+	}{
+		{SeverityInfo, "info"},
+		{SeverityWarning, "warning"},
+		{SeverityError, "error"},
+		{SeverityCritical, "critical"},
+	}
+	for _, tt := range tests {
+		if got := tt.sev.String(); got != tt.name {
+			t.Errorf("expected %q, got %q", tt.name, got)
+		}
+		data, err := json.Marshal(tt.sev)
+		if err != nil || string(data) != `"`+tt.name+`"` {
+			t.Errorf("expected JSON %q, got %s (%v)", tt.name, data, err)
+		}
+		var back Severity
+		if err := json.Unmarshal(data, &back); err != nil || back != tt.sev {
+			t.Errorf("round trip of %s: got %v (%v)", tt.name, back, err)
+		}
+	}
+	if got := Severity(9).String(); got != "severity(9)" {
+		t.Errorf("unexpected out-of-range name %q", got)
+	}
+	var s Severity
+	if err := json.Unmarshal([]byte(`"fatal"`), &s); err == nil {
+		t.Error("expected an unknown name to fail")
+	}
+}
+
+func TestCategoryString(t *testing.T) {
+	for _, c := range []Category{CategoryAuth, CategoryClient, CategoryServer, CategoryDownstream} {
+		data, _ := json.Marshal(c)
+		if c.String() != string(c) || string(data) != `"`+string(c)+`"` {
+			t.Errorf("unexpected forms for %s: %q %s", c, c.String(), data)
+		}
+	}
+}
+
+func TestErrorSeverity(t *testing.T) {
+	tests := []struct {
+		err  *Error
+		want Severity
+	}{
+		{From(errors.New("bug")), SeverityCritical},
+		{New("UNREGISTERED", 0, ""), SeverityCritical},
+		{Unavailable(""), SeverityError},
+		{Downstream("payments", nil), SeverityError},
+		{NotFound(""), SeverityWarning},
+		{Unauthorized(""), SeverityWarning},
+		{New(CodeCanceled, CanceledStatus, ""), SeverityInfo},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Severity(); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.err.Code, tt.want, got)
+		}
+	}
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Error("failed", "error", Internal(""))
+	if !bytes.Contains(buf.Bytes(), []byte(`"severity":"critical"`)) || !bytes.Contains(buf.Bytes(), []byte(`"category":"server"`)) {
+		t.Errorf("expected named severity and category in logs, got %s", buf.String())
+	}
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+
+	ctx := WithTraceID(context.Background(), "trace-log")
+	Log(ctx, errors.New("db down"))
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("expected a JSON log record: %v (%s)", err, buf.String())
+	}
+	if rec["level"] != "ERROR" {
+		t.Errorf("expected a 500 at error level, got %v", rec["level"])
+	}
+	e, _ := rec["error"].(map[string]any)
+	if e["trace_id"] != "trace-log" || e["code"] != string(CodeInternal) {
+		t.Errorf("expected the trace ID and code in the record, got %v", rec["error"])
+	}
+
+	buf.Reset()
+	Log(ctx, NotFound("user 42"))
+	if !bytes.Contains(buf.Bytes(), []byte(`"level":"WARN","msg":"user 42"`)) {
+		t.Errorf("expected a 404 at warn level, got %s", buf.String())
+	}
+
+	buf.Reset()
+	Log(ctx, nil)
+	if buf.Len() != 0 {
+		t.Errorf("expected nothing logged for nil, got %s", buf.String())
+	}
+}
@@ -0,0 +1,42 @@
+package errenvelope
+
+import "net/http"
+
+// WriteSSEError writes the error as a Server-Sent Events "error" event:
+//
+//	event: error
+//	data: {"code":"UNAVAILABLE",...}
+//
+// The stream is already open, so no status or headers are written; the
+// event is flushed immediately if w supports http.Flusher. Errors are
+// mapped with From and serialized exactly as in Write. A nil error is a no-op.
+func WriteSSEError(w http.ResponseWriter, err error) {
+	defaultEnvelope().WriteSSEError(w, err)
+}
+
+// WriteSSEError is like the package-level WriteSSEError, using env's configuration.
+func (env *Envelope) WriteSSEError(w http.ResponseWriter, err error) {
+	e := env.From(err)
+	if e == nil {
+		return
+	}
+
+	// Copy, since a marshal failure drops details from the value encoded
+	c := *e
+	body := env.marshalBody(nil, &c, shapeBare)
+	defer releaseBodyBuffer(body)
+	data := body.Bytes()
+
+	buf := make([]byte, 0, len(data)+len("event: error\ndata: \n"))
+	buf = append(buf, "event: error\ndata: "...)
+	buf = append(buf, data...)
+	buf = append(buf, '\n')
+	if _, wErr := w.Write(buf); wErr != nil {
+		env.reportWriteError(nil, wErr, IsClientDisconnect(wErr))
+		return
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,41 @@
+package errenvelope
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteSSEError(t *testing.T) {
+	w := httptest.NewRecorder()
+	w.WriteHeader(http.StatusOK) // stream already open
+
+	e := Unavailable("stream interrupted").WithTraceID("trace-sse")
+	e.ErrorID = "err-sse"
+	WriteSSEError(w, e)
+
+	want := "event: error\n" +
+		`data: {"code":"UNAVAILABLE","message":"stream interrupted","trace_id":"trace-sse","error_id":"err-sse","retryable":true,"transient":true}` +
+		"\n\n"
+	if got := w.Body.String(); got != want {
+		t.Errorf("unexpected SSE framing:\nwant %q\ngot  %q", want, got)
+	}
+	if !w.Flushed {
+		t.Error("expected event to be flushed")
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status to stay %d, got %d", http.StatusOK, w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "" {
+		t.Errorf("expected no Content-Type to be set, got %s", ct)
+	}
+}
+
+func TestWriteSSEErrorNil(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteSSEError(w, nil)
+
+	if w.Body.Len() != 0 || w.Flushed {
+		t.Error("expected nil error to write nothing")
+	}
+}
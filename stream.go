@@ -0,0 +1,81 @@
+package errenvelope
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Encode maps err with From and writes its JSON envelope to w, followed by
+// a newline, without any HTTP status or headers, e.g. to log an error to a
+// file or publish it to a queue. The body is the same as Write's, honoring
+// AlwaysArray. Successive calls produce NDJSON that StreamReader can read.
+// A nil err writes nothing. Returns the marshal or write error, if any.
+func Encode(w io.Writer, err error) error {
+	return defaultEnvelope().Encode(w, err)
+}
+
+// Encode is like the package-level Encode, using env's configuration.
+func (env *Envelope) Encode(w io.Writer, err error) error {
+	e := env.From(err)
+	if e == nil {
+		return nil
+	}
+	data, mErr := json.Marshal(env.envelopeValue(e))
+	if mErr != nil {
+		return fmt.Errorf("errenvelope: marshal %s envelope: %w", e.Code, mErr)
+	}
+	_, wErr := w.Write(append(data, '\n'))
+	return wErr
+}
+
+// StreamReader decodes a stream of newline-delimited envelopes (NDJSON),
+// e.g. the error report of a batch import. Blank lines are skipped.
+//
+//	sr := errenvelope.NewStreamReader(resp.Body)
+//	for {
+//	    e, err := sr.Next()
+//	    if err == io.EOF {
+//	        break
+//	    }
+//	    if err != nil {
+//	        return err
+//	    }
+//	    // ...
+//	}
+type StreamReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewStreamReader returns a StreamReader reading from r. Each line may be
+// up to 1 MiB, like the body limit of ReadFrom.
+func NewStreamReader(r io.Reader) *StreamReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), maxEnvelopeBytes)
+	return &StreamReader{scanner: s}
+}
+
+// Next returns the next envelope, decoded as by ReadFrom. It returns
+// io.EOF once the stream is exhausted. A line that isn't an envelope
+// yields an error naming the line; reading can continue after it.
+func (sr *StreamReader) Next() (*Error, error) {
+	for sr.scanner.Scan() {
+		sr.line++
+		line := bytes.TrimSpace(sr.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		e, err := ReadFrom(bytes.NewReader(line))
+		if err != nil {
+			return nil, fmt.Errorf("errenvelope: stream line %d: %w", sr.line, err)
+		}
+		return e, nil
+	}
+	if err := sr.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("errenvelope: read stream: %w", err)
+	}
+	return nil, io.EOF
+}
@@ -0,0 +1,97 @@
+package errenvelope
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStreamReader(t *testing.T) {
+	stream := `{"code":"VALIDATION_FAILED","message":"row 1","retryable":false}
+
+{"code":"CONFLICT","message":"row 7","retryable":false,"details":{"row":7}}
+   
+{"code":"UNAVAILABLE","message":"row 9","retryable":true,"retry_after":"5s"}
+`
+	sr := NewStreamReader(strings.NewReader(stream))
+
+	var got []*Error
+	for {
+		e, err := sr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, e)
+	}
+	if len(got) != 3 {
+		t.Fatalf("expected 3 envelopes, got %d", len(got))
+	}
+	if got[0].Code != CodeValidationFailed || got[1].Code != CodeConflict || got[2].Code != CodeUnavailable {
+		t.Errorf("unexpected codes: %s %s %s", got[0].Code, got[1].Code, got[2].Code)
+	}
+	if got[2].RetryAfter != 5*time.Second || !got[2].Retryable {
+		t.Errorf("expected retry fields decoded, got %+v", got[2])
+	}
+
+	// EOF is sticky
+	if _, err := sr.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF again, got %v", err)
+	}
+}
+
+func TestStreamReaderBadLine(t *testing.T) {
+	sr := NewStreamReader(strings.NewReader("{\"code\":\"NOT_FOUND\"}\nnot json\n{\"code\":\"GONE\"}\n"))
+	if e, err := sr.Next(); err != nil || e.Code != CodeNotFound {
+		t.Fatalf("expected first envelope, got %v %v", e, err)
+	}
+	if _, err := sr.Next(); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error naming line 2, got %v", err)
+	}
+	if e, err := sr.Next(); err != nil || e.Code != CodeGone {
+		t.Errorf("expected reading to continue, got %v %v", e, err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	ErrorIDGenerator = nil
+	t.Cleanup(func() { ErrorIDGenerator = newTraceID })
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, NotFound("row 1").WithTraceID("trace-1")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&buf, fmt.Errorf("insert: %w", Conflict("taken"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := Encode(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := `{"code":"NOT_FOUND","message":"row 1","trace_id":"trace-1","retryable":false}` + "\n" +
+		`{"code":"CONFLICT","message":"taken","retryable":false}` + "\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	// The output reads back as NDJSON
+	sr := NewStreamReader(&buf)
+	if e, err := sr.Next(); err != nil || e.Code != CodeNotFound {
+		t.Errorf("expected NOT_FOUND read back, got %+v (%v)", e, err)
+	}
+
+	// Marshal failures are returned, not swallowed
+	bad := Internal("x").WithDetails(map[string]any{"ch": make(chan int)})
+	if err := Encode(io.Discard, bad); err == nil {
+		t.Error("expected the marshal error")
+	}
+	env := &Envelope{AlwaysArray: true}
+	buf.Reset()
+	if err := env.Encode(&buf, Gone("")); err != nil || !strings.HasPrefix(buf.String(), `{"errors":[`) {
+		t.Errorf("expected an errors array, got %q (%v)", buf.String(), err)
+	}
+}
@@ -0,0 +1,51 @@
+package errenvelope
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Trailers set by WriteTrailerError.
+const (
+	TrailerErrorCode    = "X-Error-Code"
+	TrailerErrorMessage = "X-Error-Message"
+)
+
+// DeclareErrorTrailers announces the trailers WriteTrailerError sets, via
+// the Trailer header. Call it before the first Write or WriteHeader of a
+// streamed response; trailers that weren't declared are dropped.
+//
+//	errenvelope.DeclareErrorTrailers(w)
+//	for rows.Next() {
+//	    // ... stream rows
+//	}
+//	if err := rows.Err(); err != nil {
+//	    errenvelope.WriteTrailerError(w, err)
+//	}
+func DeclareErrorTrailers(w http.ResponseWriter) {
+	w.Header().Add("Trailer", TrailerErrorCode)
+	w.Header().Add("Trailer", TrailerErrorMessage)
+}
+
+// WriteTrailerError reports an error that happened after the status and
+// body were sent, by setting the X-Error-Code and X-Error-Message
+// trailers. The handler must have called DeclareErrorTrailers first. The
+// error is mapped with From; a nil error is a no-op.
+func WriteTrailerError(w http.ResponseWriter, err error) {
+	defaultEnvelope().WriteTrailerError(w, err)
+}
+
+// WriteTrailerError is like the package-level WriteTrailerError, using env's configuration.
+func (env *Envelope) WriteTrailerError(w http.ResponseWriter, err error) {
+	e := env.From(err)
+	if e == nil {
+		return
+	}
+	w.Header().Set(TrailerErrorCode, string(e.Code))
+	w.Header().Set(TrailerErrorMessage, trailerValue(e.Message))
+}
+
+// trailerValue folds line breaks, which can't appear in a header value.
+func trailerValue(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+}
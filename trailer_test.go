@@ -0,0 +1,37 @@
+package errenvelope
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteTrailerError(t *testing.T) {
+	w := httptest.NewRecorder()
+	DeclareErrorTrailers(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(`{"rows":[`))
+	WriteTrailerError(w, Unavailable("database went away\nmid-stream"))
+
+	res := w.Result()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected the status already sent, got %d", res.StatusCode)
+	}
+	if got := res.Trailer.Get(TrailerErrorCode); got != string(CodeUnavailable) {
+		t.Errorf("expected code trailer, got %q", got)
+	}
+	if got := res.Trailer.Get(TrailerErrorMessage); got != "database went away mid-stream" {
+		t.Errorf("expected message trailer, got %q", got)
+	}
+
+	// Plain errors are mapped with From; nil is a no-op
+	w = httptest.NewRecorder()
+	DeclareErrorTrailers(w)
+	w.Write([]byte("partial"))
+	WriteTrailerError(w, errors.New("disk full"))
+	WriteTrailerError(w, nil)
+	if got := w.Result().Trailer.Get(TrailerErrorCode); got != string(CodeInternal) {
+		t.Errorf("expected INTERNAL trailer, got %q", got)
+	}
+}
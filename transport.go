@@ -0,0 +1,90 @@
+package errenvelope
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// ClientTransport is an http.RoundTripper for clients of err-envelope
+// services. It propagates the trace ID from the request context (see
+// WithTraceID and TraceMiddleware) as an outbound header, and turns
+// error responses (status >= 400) carrying an envelope into an *Error
+// returned from the round trip. Both behaviors are on by default. The
+// hop count set by HopLimitMiddleware is forwarded as X-Request-Hops.
+//
+// Example:
+//
+//	client := &http.Client{Transport: &errenvelope.ClientTransport{}}
+//	resp, err := client.Do(req.WithContext(r.Context()))
+//	var e *errenvelope.Error
+//	if errors.As(err, &e) && e.Code == errenvelope.CodeNotFound {
+//	    // ...
+//	}
+//
+// Error responses whose body isn't an envelope are returned unchanged.
+type ClientTransport struct {
+	// Base performs the request. Defaults to http.DefaultTransport.
+	Base http.RoundTripper
+
+	// TraceHeader is the outbound trace header. Defaults to HeaderTraceID.
+	TraceHeader string
+
+	// DisableTrace turns off trace ID propagation.
+	DisableTrace bool
+
+	// DisableErrors turns off parsing error responses into *Error.
+	DisableErrors bool
+}
+
+// RoundTrip implements http.RoundTripper. The request is cloned before
+// the trace and hop headers are added, and existing headers are kept.
+func (t *ClientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := t.TraceHeader
+	if header == "" {
+		header = HeaderTraceID
+	}
+	if !t.DisableTrace && req.Header.Get(header) == "" {
+		if id := traceIDFromContext(req.Context()); id != "" {
+			req = req.Clone(req.Context())
+			req.Header.Set(header, id)
+		}
+	}
+	if hops, ok := hopsFromContext(req.Context()); ok && req.Header.Get(HeaderRequestHops) == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set(HeaderRequestHops, strconv.Itoa(hops))
+	}
+
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	resp, err := base.RoundTrip(req)
+	if err != nil || t.DisableErrors || resp.StatusCode < 400 {
+		return resp, err
+	}
+
+	// Buffer the body so it can be handed back if it isn't an envelope
+	orig := resp.Body
+	data, readErr := io.ReadAll(io.LimitReader(orig, maxEnvelopeBytes))
+	if readErr != nil || len(data) == maxEnvelopeBytes {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(data), orig), orig}
+		return resp, nil
+	}
+	orig.Close()
+
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	e, parseErr := Parse(resp)
+	if parseErr != nil {
+		resp.Body = io.NopCloser(bytes.NewReader(data))
+		return resp, nil
+	}
+	if e.TraceID == "" && header != HeaderTraceID {
+		e.TraceID = resp.Header.Get(header)
+	}
+	return nil, e
+}
@@ -0,0 +1,83 @@
+package errenvelope
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientTransport(t *testing.T) {
+	var gotTrace string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTrace = r.Header.Get(HeaderTraceID)
+		switch r.URL.Path {
+		case "/missing":
+			Write(w, r, NotFound("User not found"))
+		case "/plain":
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &ClientTransport{}}
+	ctx := WithTraceID(context.Background(), "trace-out")
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", srv.URL+"/missing", nil)
+	_, err := client.Do(req)
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("expected *Error, got %v", err)
+	}
+	if e.Code != CodeNotFound || e.Status != http.StatusNotFound || e.Message != "User not found" {
+		t.Errorf("unexpected error: %+v", e)
+	}
+	if gotTrace != "trace-out" || e.TraceID != "trace-out" {
+		t.Errorf("expected trace propagated both ways, got %q / %q", gotTrace, e.TraceID)
+	}
+	if req.Header.Get(HeaderTraceID) != "" {
+		t.Error("expected the caller's request to be left unchanged")
+	}
+
+	// Non-envelope error bodies pass through
+	req, _ = http.NewRequestWithContext(ctx, "GET", srv.URL+"/plain", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected plain error response to pass through, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || string(body) != "bad gateway\n" {
+		t.Errorf("expected original response, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestClientTransportToggles(t *testing.T) {
+	var gotTrace string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTrace = r.Header.Get(HeaderTraceID)
+		Write(w, r, NotFound(""))
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &ClientTransport{DisableTrace: true, DisableErrors: true}}
+	req, _ := http.NewRequestWithContext(WithTraceID(context.Background(), "trace-out"), "GET", srv.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("expected the raw response, got %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", resp.StatusCode)
+	}
+	if gotTrace == "trace-out" {
+		t.Error("expected no trace propagation when disabled")
+	}
+	if e, err := Parse(resp); err != nil || e.Code != CodeNotFound {
+		t.Errorf("expected the body left for the caller, got %v %v", e, err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package validation provides lightweight struct-tag validation that
+// produces err-envelope validation errors.
+//
+// It supports a small set of rules via the `validate` struct tag and
+// exists for simple request structs where pulling in a full validator
+// library is not worth it.
+//
+// Supported rules:
+//
+//	required   value must not be the zero value
+//	min=N      strings/slices/maps: length >= N; numbers: value >= N
+//	max=N      strings/slices/maps: length <= N; numbers: value <= N
+//	email      string must look like an email address (basic check)
+//
+// Field names in the resulting errors use the `json` tag name when present.
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	errenvelope "github.com/blackwell-systems/err-envelope"
+)
+
+// ValidateStruct validates v using `validate` struct tags.
+// Returns nil when v is valid, or a VALIDATION_FAILED error with
+// field-level details otherwise. v must be a struct or a pointer to one.
+//
+// Example:
+//
+//	type SignupRequest struct {
+//	    Email    string `json:"email" validate:"required,email"`
+//	    Password string `json:"password" validate:"required,min=8"`
+//	}
+//
+//	if err := validation.ValidateStruct(req); err != nil {
+//	    errenvelope.Write(w, r, err)
+//	    return
+//	}
+func ValidateStruct(v any) *errenvelope.Error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return errenvelope.Internal("validation: nil struct pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return errenvelope.Internalf("validation: expected struct, got %s", rv.Kind())
+	}
+
+	fields := errenvelope.FieldErrors{}
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		tag := sf.Tag.Get("validate")
+		if tag == "" || !sf.IsExported() {
+			continue
+		}
+		if msg := check(rv.Field(i), tag); msg != "" {
+			fields[fieldName(sf)] = msg
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return errenvelope.Validation(fields)
+}
+
+// check applies the comma-separated rules to fv and returns the first
+// failure message, or "" if all rules pass.
+func check(fv reflect.Value, tag string) string {
+	rules := strings.Split(tag, ",")
+
+	if fv.IsZero() {
+		for _, rule := range rules {
+			if strings.TrimSpace(rule) == "required" {
+				return "is required"
+			}
+		}
+		// Optional and empty: nothing else to check
+		return ""
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "min":
+			if msg := checkBound(fv, arg, true); msg != "" {
+				return msg
+			}
+		case "max":
+			if msg := checkBound(fv, arg, false); msg != "" {
+				return msg
+			}
+		case "email":
+			if fv.Kind() == reflect.String && !isEmail(fv.String()) {
+				return "must be a valid email"
+			}
+		}
+	}
+	return ""
+}
+
+func checkBound(fv reflect.Value, arg string, isMin bool) string {
+	n, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return ""
+	}
+
+	var got float64
+	var unit string
+	switch fv.Kind() {
+	case reflect.String:
+		got, unit = float64(len([]rune(fv.String()))), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		got, unit = float64(fv.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		got = float64(fv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		got = float64(fv.Uint())
+	case reflect.Float32, reflect.Float64:
+		got = fv.Float()
+	default:
+		return ""
+	}
+
+	if isMin && got < n {
+		return fmt.Sprintf("must be at least %s%s", arg, unit)
+	}
+	if !isMin && got > n {
+		return fmt.Sprintf("must be at most %s%s", arg, unit)
+	}
+	return ""
+}
+
+// isEmail is a deliberately basic check: one "@", a non-empty local part,
+// and a domain containing a dot that is not at either end.
+func isEmail(s string) bool {
+	local, domain, ok := strings.Cut(s, "@")
+	if !ok || local == "" || strings.Contains(domain, "@") {
+		return false
+	}
+	dot := strings.LastIndex(domain, ".")
+	return dot > 0 && dot < len(domain)-1 && !strings.ContainsAny(s, " \t\r\n")
+}
+
+func fieldName(sf reflect.StructField) string {
+	if tag := sf.Tag.Get("json"); tag != "" {
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
@@ -0,0 +1,97 @@
+package validation
+
+import (
+	"net/http"
+	"testing"
+
+	errenvelope "github.com/blackwell-systems/err-envelope"
+)
+
+type signupRequest struct {
+	Name     string `json:"name" validate:"required"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=8,max=64"`
+	Age      int    `json:"age" validate:"min=18"`
+	Nickname string `validate:"max=3"`
+}
+
+func TestValidateStructValid(t *testing.T) {
+	req := signupRequest{Name: "Ada", Email: "ada@example.com", Password: "correct-horse", Age: 30}
+	if err := ValidateStruct(req); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if err := ValidateStruct(&req); err != nil {
+		t.Fatalf("expected nil for pointer, got %v", err)
+	}
+}
+
+func TestValidateStructInvalid(t *testing.T) {
+	req := signupRequest{Email: "not-an-email", Password: "short", Age: 12, Nickname: "toolong"}
+
+	err := ValidateStruct(req)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	if err.Code != errenvelope.CodeValidationFailed {
+		t.Errorf("expected code %s, got %s", errenvelope.CodeValidationFailed, err.Code)
+	}
+	if err.Status != http.StatusBadRequest {
+		t.Errorf("expected status %d, got %d", http.StatusBadRequest, err.Status)
+	}
+
+	details, ok := err.Details.(errenvelope.ValidationDetails)
+	if !ok {
+		t.Fatal("expected ValidationDetails")
+	}
+
+	want := errenvelope.FieldErrors{
+		"name":     "is required",
+		"email":    "must be a valid email",
+		"password": "must be at least 8 characters",
+		"age":      "must be at least 18",
+		"Nickname": "must be at most 3 characters",
+	}
+	if len(details.Fields) != len(want) {
+		t.Errorf("expected %d field errors, got %d: %v", len(want), len(details.Fields), details.Fields)
+	}
+	for field, msg := range want {
+		if details.Fields[field] != msg {
+			t.Errorf("expected %s error %q, got %q", field, msg, details.Fields[field])
+		}
+	}
+}
+
+func TestValidateStructOptionalEmpty(t *testing.T) {
+	type optional struct {
+		Website string `json:"website" validate:"email"`
+	}
+	if err := ValidateStruct(optional{}); err != nil {
+		t.Errorf("expected nil for empty optional field, got %v", err)
+	}
+}
+
+func TestValidateStructNonStruct(t *testing.T) {
+	err := ValidateStruct("not a struct")
+	if err == nil || err.Code != errenvelope.CodeInternal {
+		t.Errorf("expected internal error, got %v", err)
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	tests := map[string]bool{
+		"ada@example.com":  true,
+		"a@b.co":           true,
+		"missing-at.com":   false,
+		"@example.com":     false,
+		"ada@example":      false,
+		"ada@.com":         false,
+		"ada@example.":     false,
+		"a@b@example.com":  false,
+		"ada @example.com": false,
+	}
+	for in, want := range tests {
+		if got := isEmail(in); got != want {
+			t.Errorf("isEmail(%q) = %v, want %v", in, got, want)
+		}
+	}
+}